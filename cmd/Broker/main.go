@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/QzSG/lapis-uno/cmd/internal/broker"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	listen    string
+	tlsListen string
+	certFile  string
+	tlsKey    string
+	anonymous bool
+
+	loader *config.Loader
+	cfg    *config.Config
+)
+
+func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
+	sig := <-sigs
+	log.WithFields(log.Fields{
+		"signal": sig,
+	}).Info("Signal Received")
+	done <- struct{}{}
+}
+
+func init() {
+	flag.StringVar(&listen, "listen", ":1883", "Address to accept plain TCP MQTT clients on, pass empty string to disable")
+	flag.StringVar(&tlsListen, "tlslisten", "", "Optional, address to accept MQTT over TLS clients on, for example: -tlslisten=:8883, requires -cert and -tlskey")
+	flag.StringVar(&certFile, "cert", "", "TLS certificate file for -tlslisten")
+	flag.StringVar(&tlsKey, "tlskey", "", "TLS private key file for -tlslisten")
+	flag.BoolVar(&anonymous, "anonymous", false, "Accept clients without checking MQTT username and password")
+	loader = config.NewLoader(flag.CommandLine, config.Default(), config.MQTTUser, config.MQTTPassword)
+
+	log.SetOutput(os.Stdout)
+	log.SetLevel(log.DebugLevel)
+}
+
+func main() {
+	// Signal stuff to handle graceful exits
+	signalChan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go handleSignals(signalChan, done)
+
+	flag.Parse()
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if listen == "" && tlsListen == "" {
+		log.Fatal("Nothing to listen on, pass -listen and/or -tlslisten")
+	}
+
+	b := broker.New(broker.Options{
+		Username:       cfg.Broker.Username,
+		Password:       cfg.Broker.Password,
+		AllowAnonymous: anonymous,
+	})
+
+	if listen != "" {
+		go func() {
+			if err := b.ListenAndServe(listen); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+	if tlsListen != "" {
+		go func() {
+			if err := b.ListenAndServeTLS(tlsListen, certFile, tlsKey); err != nil {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// Signal stuff
+	<-done
+	b.Close()
+}
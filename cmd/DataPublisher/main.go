@@ -1,18 +1,21 @@
 package main
 
 import (
-	"crypto/tls"
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	ntp "github.com/QzSG/lapis-uno/cmd/NTP"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	"github.com/QzSG/lapis-uno/cmd/internal/publisher"
 	pb "github.com/QzSG/lapis-uno/protobuf"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
@@ -20,12 +23,22 @@ import (
 	"google.golang.org/grpc"
 )
 
+const publishFlush = 2 * time.Second // max wait on exit for buffered readings to be published
+
 var (
-	clock      = time.Now()
+	clock      = ntp.NewSyncedClock()
 	port       = 10101
-	offset     time.Duration
+	clockSync  *ntp.Resync
 	grpcServer *grpc.Server
+	sensorSrv  *sensorServer
 	cid        string
+	bufferSize int
+
+	batchSize   int
+	batchWindow time.Duration
+
+	loader *config.Loader
+	cfg    *config.Config
 )
 
 func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
@@ -34,24 +47,213 @@ func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 		"signal": sig,
 	}).Info("Signal Received")
 	grpcServer.GracefulStop()
+	if sensorSrv != nil {
+		sensorSrv.batcher.flush()
+		sensorSrv.publisher.Stop(publishFlush)
+	}
+	if clockSync != nil {
+		clockSync.Stop()
+	}
 	done <- struct{}{}
 }
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
 	flag.StringVar(&cid, "cid", "lapis-client-pub-"+fmt.Sprint(rand.Intn(1000)), "If not provided, defaults to lapis-client-pub-X where X is a random int between 1 & 1000")
+	flag.IntVar(&bufferSize, "buffer", 3000, "Max number of publishes (readings or batches) buffered while disconnected from MQTT broker, defaults to 3000 (1 minute of single readings at 50Hz)")
+	flag.IntVar(&batchSize, "batch", 1, "Max number of readings per MQTT publish, defaults to 1 which publishes every reading on its own to sensor/<cid>/data, above 1 batches are published to sensor/<cid>/batch")
+	flag.DurationVar(&batchWindow, "batchwindow", 100*time.Millisecond, "Max time a reading waits for its batch to fill before the batch is published anyway, only used with -batch above 1")
+	loader = config.NewLoader(flag.CommandLine, config.Default(), config.Broker, config.MQTTUser, config.MQTTPassword, config.BrokerCA,
+		config.StartQoS, config.DataQoS, config.Retain, config.NTPServers, config.NTPResync)
 
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
 
+// batcher : Collects readings into ReadingBatch publishes of up to size readings
+// A batch is published once it is full, once window passed since its first reading or as soon as it holds a start of move reading
+// so sync delay calculation is not held up, it is published with the highest QoS of its readings
+// With size 1 or less every reading is published on its own as before
+type batcher struct {
+	size       int
+	window     time.Duration
+	publisher  *publisher.Publisher
+	topic      string // single readings
+	batchTopic string
+
+	mu    sync.Mutex
+	batch *pb.ReadingBatch
+	dones []func(error)
+	qos   byte
+	timer *time.Timer
+}
+
+// add : Queues reading, done is called once it was published or failed to be
+func (b *batcher) add(reading *pb.Reading, done func(error)) {
+	qos := cfg.Broker.QoS(reading.IsStartMove)
+	if b.size <= 1 {
+		b.publisher.PublishEncode(b.topic, qos, cfg.Broker.Retain, func() []byte {
+			return encodeReadings(reading, []*pb.Reading{reading})
+		}, done)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.batch == nil {
+		batch := &pb.ReadingBatch{}
+		b.batch = batch
+		b.qos = qos
+		b.timer = time.AfterFunc(b.window, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.batch == batch { // a stale timer must not cut the next batch short
+				b.flushLocked()
+			}
+		})
+	}
+	b.batch.Readings = append(b.batch.Readings, reading)
+	b.dones = append(b.dones, done)
+	if qos > b.qos {
+		b.qos = qos
+	}
+	if len(b.batch.Readings) >= b.size || reading.IsStartMove {
+		b.flushLocked()
+	}
+}
+
+// flush : Publishes the pending batch, if any
+func (b *batcher) flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+func (b *batcher) flushLocked() {
+	if b.batch == nil {
+		return
+	}
+	b.timer.Stop()
+	log.Debug("Publishing batch of ", len(b.batch.Readings), " readings")
+	batch, dones := b.batch, b.dones
+	encode := func() []byte {
+		return encodeReadings(batch, batch.Readings)
+	}
+	b.publisher.PublishEncode(b.batchTopic, b.qos, cfg.Broker.Retain, encode, func(err error) {
+		for _, done := range dones {
+			done(err)
+		}
+	})
+	b.batch = nil
+	b.dones = nil
+}
+
+// encodeReadings : Stamps readings with the publish time then marshals msg, called right before every publish attempt
+func encodeReadings(msg proto.Message, readings []*pb.Reading) []byte {
+	now := clock.Now().UnixNano()
+	for _, reading := range readings {
+		reading.PublishTime = now
+	}
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		log.Fatalln("Failed to encode sensor reading:", err)
+	}
+	return payload
+}
+
+// maxBackoffHint : Pause suggested to gRPC clients once the publish buffer is full
+const maxBackoffHint = time.Second
+
+// streamAcks : Tracks which readings of a gRPC stream were published, readings are numbered from 1 in the order received
+// These stream seqs are what replies refer to, separate from the per clientID Reading.seq seen by subscribers
+type streamAcks struct {
+	mu       sync.Mutex
+	last     uint64          // seq of the last reading received
+	acked    uint64          // every seq up to acked was published or failed
+	resolved map[uint64]bool // published or failed seqs above acked
+	failed   []uint64        // failed since the last reply
+}
+
+func newStreamAcks() *streamAcks {
+	return &streamAcks{resolved: make(map[uint64]bool)}
+}
+
+// next : Numbers the next reading, the returned func records whether it was published
+func (a *streamAcks) next() func(error) {
+	a.mu.Lock()
+	a.last++
+	seq := a.last
+	a.mu.Unlock()
+	return func(err error) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if err != nil {
+			log.Debug("Reading ", seq, " was not published | ", err)
+			a.failed = append(a.failed, seq)
+		}
+		a.resolved[seq] = true
+		for a.resolved[a.acked+1] {
+			delete(a.resolved, a.acked+1)
+			a.acked++
+		}
+	}
+}
+
 type sensorServer struct {
 	pb.UnimplementedSensorServer
-	mqttClient mqtt.Client
-	topic      string
+	publisher *publisher.Publisher
+	batcher   *batcher
+
+	seqMu    sync.Mutex
+	seqs     map[string]uint64 // last seq assigned per clientID
+	seqEpoch int64
+}
+
+// accept : Timestamps and numbers reading then queues it for publishing
+// Timestamp is set before queuing so buffered readings keep their original time when replayed, publish time is set once sent
+// Readings are queued in seq order so a gap seen by subscribers means readings were lost
+func (s *sensorServer) accept(reading *pb.Reading, acks *streamAcks) {
+	log.Debug("Reading : ", reading)
+	if reading.SampleTime == 0 {
+		reading.SampleTime = reading.TimeStamp // keep the device time of clients predating sampleTime
+	}
+	reading.ReceiveTime = clock.Now().UnixNano()
+	reading.TimeStamp = reading.ReceiveTime
+
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+	s.seqs[reading.ClientID]++
+	reading.Seq = s.seqs[reading.ClientID]
+	reading.SeqEpoch = s.seqEpoch
+	s.batcher.add(reading, acks.next())
+}
+
+// reply : Returns the reply for the readings received so far on a stream
+// The backoff hint grows from 0 with half of the publish buffer in use to maxBackoffHint once it is full
+func (s *sensorServer) reply(acks *streamAcks) *pb.Reply {
+	usage := float64(s.publisher.Len()) / float64(s.publisher.Cap())
+	r := &pb.Reply{
+		Status:          pb.Reply_QUEUED,
+		BrokerConnected: s.publisher.Connected(),
+		BufferUsage:     float32(usage),
+		BufferFull:      usage >= 1,
+	}
+	if usage > 0.5 {
+		r.BackoffMs = uint32(math.Min(1, (usage-0.5)/0.5) * float64(maxBackoffHint/time.Millisecond))
+	}
+
+	acks.mu.Lock()
+	defer acks.mu.Unlock()
+	r.StreamSeq = acks.last
+	r.AckedStreamSeq = acks.acked
+	r.FailedStreamSeqs = acks.failed
+	acks.failed = nil
+	return r
 }
 
+// ReadingStream : Replies to every reading with its stream seq and the publish state of the readings before it
 func (s *sensorServer) ReadingStream(stream pb.Sensor_ReadingStreamServer) error {
+	acks := newStreamAcks()
 	for {
 		in, err := stream.Recv()
 		if err == io.EOF {
@@ -60,18 +262,31 @@ func (s *sensorServer) ReadingStream(stream pb.Sensor_ReadingStreamServer) error
 		if err != nil {
 			return err
 		}
-		reading := in
+		s.accept(in, acks)
 
-		log.Debug("Reading : ", reading)
-		reading.TimeStamp = clock.Add(time.Since(clock) + offset).UnixNano()
-		payload, err := proto.Marshal(reading)
+		if err := stream.Send(s.reply(acks)); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadingBatchStream : Same as ReadingStream with one Reply per batch
+// Readings of a batch all get the time the batch arrived, so send a start of move reading without waiting for the batch to fill
+func (s *sensorServer) ReadingBatchStream(stream pb.Sensor_ReadingBatchStreamServer) error {
+	acks := newStreamAcks()
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			log.Fatalln("Failed to encode sensor reading:", err)
+			return err
+		}
+		for _, reading := range in.Readings {
+			s.accept(reading, acks)
 		}
-		token := s.mqttClient.Publish(s.topic, 0, false, payload)
-		token.Wait()
 
-		if err := stream.Send(&pb.Reply{Status: 1}); err != nil {
+		if err := stream.Send(s.reply(acks)); err != nil {
 			return err
 		}
 	}
@@ -79,35 +294,47 @@ func (s *sensorServer) ReadingStream(stream pb.Sensor_ReadingStreamServer) error
 
 func newServer() *sensorServer {
 	var ClientID = cid
-	const BrokerConfig = "ssl://mqtts.qz.sg:8883"
+	var BrokerConfig = cfg.Broker.URL
 
 	log.Info("Connecting to " + BrokerConfig + " with ClientID " + ClientID)
 
-	tlsConfig := &tls.Config{
-		//Go will dig out and use the System RootCA cert set if nothing is passed in
-		ClientAuth: tls.NoClientCert, //we do not use client certs for auth
-		ClientCAs:  nil,
+	tlsConfig, err := cfg.Broker.TLSConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	mqttOpts := mqtt.NewClientOptions().AddBroker(BrokerConfig).SetClientID(ClientID)
 	mqttOpts.SetTLSConfig(tlsConfig)
-	mqttOpts.SetUsername("xilinx")
-	mqttOpts.SetPassword("undecimus")
+	mqttOpts.SetUsername(cfg.Broker.Username)
+	mqttOpts.SetPassword(cfg.Broker.Password)
 	topic := fmt.Sprintf("sensor/%s/data", ClientID)
+	batchTopic := fmt.Sprintf("sensor/%s/batch", ClientID)
 
-	log.WithFields(log.Fields{
-		"Topic": topic,
-	}).Info("Client set to publish to topic")
-
-	client := mqtt.NewClient(mqttOpts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		log.Panic(token.Error())
+	if batchSize > 1 {
+		log.WithFields(log.Fields{
+			"Topic":  batchTopic,
+			"Batch":  batchSize,
+			"Window": batchWindow,
+		}).Info("Client set to publish batches to topic")
 	} else {
-		log.Info("Connected to MQTT Broker over TLS")
+		log.WithFields(log.Fields{
+			"Topic": topic,
+		}).Info("Client set to publish to topic")
 	}
+
+	pub := publisher.New(mqttOpts, bufferSize)
+	pub.Start()
 	s := &sensorServer{
-		mqttClient: client,
-		topic:      topic,
+		publisher: pub,
+		seqs:      make(map[string]uint64),
+		seqEpoch:  clock.Now().UnixNano(),
+		batcher: &batcher{
+			size:       batchSize,
+			window:     batchWindow,
+			publisher:  pub,
+			topic:      topic,
+			batchTopic: batchTopic,
+		},
 	}
 	return s
 }
@@ -123,16 +350,26 @@ func main() {
 
 	flag.Parse()
 
-	log.Info("Starting NTPClient to get offset")
-
-	clockOffset, err := ntp.Offset()
+	var err error
+	cfg, err = loader.Load()
 	if err != nil {
-		log.Error(err.Error())
+		log.Fatal(err)
+	}
+	if batchSize > 1 && batchWindow <= 0 {
+		log.Fatal("batchwindow must be positive when batching")
 	}
-	log.Info("NTP Offset:", clockOffset)
 
-	offset = clockOffset
-	log.Info("NTP Clock:", clock.Add(time.Since(clock)+clockOffset))
+	log.Info("Starting NTPClient to get offset")
+
+	ntpClient := &ntp.Client{Servers: cfg.NTP.Servers, Samples: cfg.NTP.Samples}
+	clockSync = ntpClient.StartResync(cfg.NTP.Resync, clock.Update)
+	if sample, ok, err := clockSync.Last(); ok {
+		log.Info("NTP Server:", sample.Server, " Delay:", sample.Delay)
+	} else {
+		log.Error("NTP sync failed, using system clock | ", err)
+	}
+	log.Info("NTP Offset:", clock.Offset(), " Uncertainty:", clock.Uncertainty())
+	log.Info("NTP Clock:", clock.Now())
 
 	log.Info("Starting GRPC Server on port", port)
 
@@ -142,7 +379,8 @@ func main() {
 	}
 	var opts []grpc.ServerOption
 	grpcServer = grpc.NewServer(opts...)
-	pb.RegisterSensorServer(grpcServer, newServer())
+	sensorSrv = newServer()
+	pb.RegisterSensorServer(grpcServer, sensorSrv)
 	grpcServer.Serve(listener)
 	<-done
 }
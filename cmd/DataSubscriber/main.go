@@ -2,20 +2,32 @@ package main
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	ntp "github.com/QzSG/lapis-uno/cmd/NTP"
+	"github.com/QzSG/lapis-uno/cmd/internal/broker"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	"github.com/QzSG/lapis-uno/cmd/internal/evalapi"
+	"github.com/QzSG/lapis-uno/cmd/internal/latency"
+	"github.com/QzSG/lapis-uno/cmd/internal/position"
+	"github.com/QzSG/lapis-uno/cmd/internal/segment"
+	"github.com/QzSG/lapis-uno/cmd/internal/sequence"
 	pb "github.com/QzSG/lapis-uno/protobuf"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
@@ -23,42 +35,46 @@ import (
 )
 
 var (
-	clock               = time.Now()
-	offset              time.Duration
-	file                *os.File //for single mode
-	file1, file2, file3 *os.File //for multi mode
-	c1, c2, c3          string   //for multi mode
-
-	cid            string
-	mode           string
-	evalClientConn string
-	ignore         string
-
-	start    = make(chan startPacket)
+	clock       = ntp.NewSyncedClock()
+	clockSync   *ntp.Resync
+	file        *os.File                    //for single mode
+	dancerFiles = make(map[string]*os.File) //for multi mode, keyed by clientID
+
+	cid     string
+	mode    string
+	ignore  string
+	dancers int
+
+	embedBroker string
+
+	loader *config.Loader
+	cfg    *config.Config
+
+	moveTimeout time.Duration
+	syncTimeout time.Duration
+
+	start    = make(chan segment.DancerWindow)
+	windows  = make(chan segment.MoveWindow, 10)
 	calcDone = make(chan struct{})
 
 	msgChan = make(chan message, 10) //Buffered channel for posting to evalclient using httppost
 
-	zerostartPacket = &startPacket{}
+	segmenter *segment.Segmenter //used only for multi mode
+
+	seqTracker = sequence.NewTracker(1024) // remembers about 20s of readings per client at 50Hz
+	seqReport  time.Duration
 
-	startclient1, startclient2, startclient3 startPacket //used only for multi mode
-	idleclient1, idleclient2, idleclient3    startPacket //used only for multi mode
-	startCount                               = 0
-	idleCount                                = 0
-	waitForNextMove                          = false
-	hasAllFirstStartPackets                  = false
-	hasAllFirstIdlePackets                   = false
+	latencies = latency.NewTracker()
 
-	initClients = false
+	sensorConfigs  = make(map[string]*pb.SensorConfig) // last config sent by each client
+	sensorConfigMu sync.Mutex
 )
 
 // Generic message struct
+// message : Request for EvalClient's v2 api
 type message struct {
-	msgType   string
-	data      string
-	ts        string
-	cids      string
-	extraData string
+	path string      // ie: evalapi.DelayPath
+	body interface{} // evalapi.Delay or evalapi.Positions
 }
 
 type startPacket struct {
@@ -68,10 +84,6 @@ type startPacket struct {
 	posChange int32
 }
 
-func (s *startPacket) Reset() {
-	*s = *zerostartPacket
-}
-
 func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 	sig := <-sigs
 	log.WithFields(log.Fields{
@@ -81,224 +93,381 @@ func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 	if mode != "single" {
 		calcDone <- struct{}{}
 	}
+	if clockSync != nil {
+		clockSync.Stop()
+	}
+	reportSequences()
+	reportLatencies()
 
 	done <- struct{}{}
 }
 
+// Topics readings are published to, sensor/<cid>/batch carries a ReadingBatch instead of a single Reading
+const (
+	readingTopic = "sensor/+/data"
+	batchTopic   = "sensor/+/batch"
+)
+
 var f mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
+	if strings.HasSuffix(msg.Topic(), "/batch") {
+		batch := &pb.ReadingBatch{}
+		if err := proto.Unmarshal(msg.Payload(), batch); err != nil {
+			log.Fatalln("Failed to parse sensor reading batch:", err)
+		}
+		for _, reading := range batch.Readings {
+			handleReading(reading)
+		}
+		return
+	}
 
 	reading := &pb.Reading{}
 
 	if err := proto.Unmarshal(msg.Payload(), reading); err != nil {
 		log.Fatalln("Failed to parse sensor reading:", err)
 	}
+	handleReading(reading)
+}
 
-	//fmt.Printf("Elapsed[ms]: %s\n", clock.Add(time.Since(clock)+offset).Sub(time.Unix(0, reading.GetTimeStamp())))
+// handleReading : Logs reading to csv and feeds it to the segmenter in multi mode
+// Duplicates are counted and dropped, the seq column of the csv shows any gaps left
+func handleReading(reading *pb.Reading) {
+	if !checkSequence(reading) {
+		return
+	}
+	arrival := clock.Now().UnixNano()
+	latencies.Observe(reading.ClientID, reading.SampleTime, reading.ReceiveTime, reading.PublishTime, arrival)
+	//fmt.Printf("Elapsed[ms]: %s\n", clock.Now().Sub(time.Unix(0, reading.GetTimeStamp())))
 	//fmt.Println("Reading:", reading)
 	out := fmt.Sprint(reading.IsStartMove, " ", reading.ClientID, " ", reading.DancerNo,
 		reading.AccX, reading.AccY, reading.AccZ,
-		reading.GyroRoll, reading.GyroPitch, reading.GyroYaw, reading.TimeStamp, "\n")
+		reading.GyroRoll, reading.GyroPitch, reading.GyroYaw, reading.TimeStamp, reading.Seq,
+		reading.SampleTime, reading.ReceiveTime, reading.PublishTime, arrival, " ", sensorColumns(reading), "\n")
 
 	//Multi mode
 	if mode != "single" {
+		segmenter.Add(reading, time.Now())
 
-		// If waiting for next move to start and a next start packet arrives from any client, reset bools
-		if waitForNextMove && reading.IsStartMove {
-			hasAllFirstStartPackets = false
-			hasAllFirstIdlePackets = false
-			waitForNextMove = false
+		if dancerFile, ok := dancerFiles[reading.ClientID]; ok {
+			dancerFile.WriteString(out)
+			dancerFile.Sync()
 		}
+	}
+	file.WriteString(out)
+	file.Sync()
 
-		// If all booleans reset && first move from any client, start calculation loop
-		if !hasAllFirstStartPackets && !waitForNextMove && reading.IsStartMove {
-			//log.Info("New move")
-			switch startCount {
-			case 0:
-				startclient1 = startPacket{clientID: reading.GetClientID(), timeStamp: reading.GetTimeStamp(), dancerNo: reading.GetDancerNo(), posChange: reading.GetPosChange()}
-				start <- startclient1
-				startCount++
-				log.Debug("First start packet from ", startclient1.clientID)
-			case 1:
-				if reading.ClientID != startclient1.clientID {
-					startclient2 = startPacket{clientID: reading.GetClientID(), timeStamp: reading.GetTimeStamp(), dancerNo: reading.GetDancerNo(), posChange: reading.GetPosChange()}
-					start <- startclient2
-					startCount++
-					log.Debug("Second start packet from ", startclient2.clientID)
-				}
-			case 2:
-				if (reading.ClientID != startclient1.clientID) && (reading.ClientID != startclient2.clientID) {
-					startclient3 = startPacket{clientID: reading.GetClientID(), timeStamp: reading.GetTimeStamp(), dancerNo: reading.GetDancerNo(), posChange: reading.GetPosChange()}
-					start <- startclient3
-					startCount++
-					hasAllFirstStartPackets = true
-					log.Debug("Last start packet from ", startclient3.clientID)
-					log.Debug("Received first start packets for all 3 clients")
-					log.Debug("1: ", startclient1.clientID, " 2 :", startclient2.clientID, " 3: ", startclient3.clientID)
-					startclient1.Reset()
-					startclient2.Reset()
-					startclient3.Reset()
-					startCount = 0
-				}
-			}
-		}
-		// Assumes all start packets will arrive long before first idle packet arrives
-		// If first idle packet not recv from each client, if all first start packets recved, if its not a start move, loop and wait for all idle packets (one from each client)
-		if !hasAllFirstIdlePackets && hasAllFirstStartPackets && !reading.IsStartMove {
-			//log.Debug("Entered idle")
-			switch idleCount {
-			case 0:
-				idleclient1 = startPacket{clientID: reading.GetClientID(), timeStamp: reading.GetTimeStamp(), dancerNo: reading.GetDancerNo()}
-				idleCount++
-				log.Debug("First idle packet from ", idleclient1.clientID)
-			case 1:
-				if reading.ClientID != idleclient1.clientID {
-					idleclient2 = startPacket{clientID: reading.GetClientID(), timeStamp: reading.GetTimeStamp(), dancerNo: reading.GetDancerNo()}
-					idleCount++
-					log.Debug("Second idle packet from ", idleclient2.clientID)
-				}
-			case 2:
-				if (reading.ClientID != idleclient1.clientID) && (reading.ClientID != idleclient2.clientID) {
-					idleclient3 = startPacket{clientID: reading.GetClientID(), timeStamp: reading.GetTimeStamp(), dancerNo: reading.GetDancerNo()}
-					idleCount++
-					hasAllFirstIdlePackets = true
-					log.Debug("Last idle packet from ", idleclient3.clientID)
-					log.Debug("Received first idle packets for all 3 clients, waiting for next start packet loop")
-					idleclient1.Reset()
-					idleclient2.Reset()
-					idleclient3.Reset()
-					idleCount = 0
-				}
-			}
-		}
-		// Has all first start and first idle packets, waiting for next move to start
-		if hasAllFirstStartPackets && hasAllFirstIdlePackets {
-			log.Debug("Waiting for next move to start")
-			waitForNextMove = true
-		}
+}
+
+// sensorColumns : Returns magnetometer, orientation, battery level and sample rate columns of reading
+// Readings from older devices lack these, NaN (or 0 for the sample rate) is written instead so every line has the same columns
+func sensorColumns(reading *pb.Reading) string {
+	nan := math.NaN()
+	magX, magY, magZ := nan, nan, nan
+	if mag := reading.GetMag(); mag != nil {
+		magX, magY, magZ = mag.MagX, mag.MagY, mag.MagZ
+	}
+	quatW, quatX, quatY, quatZ := nan, nan, nan, nan
+	if q := reading.GetOrientation(); q != nil {
+		quatW, quatX, quatY, quatZ = q.W, q.X, q.Y, q.Z
+	}
+	var battery interface{} = nan
+	if b := reading.GetBattery(); b != nil {
+		battery = b.Level
+	}
+	return fmt.Sprintf("%v %v %v %v %v %v %v %v %v", magX, magY, magZ, quatW, quatX, quatY, quatZ, battery,
+		sensorConfig(reading).GetSampleRateHz())
+}
+
+// sensorConfig : Returns the config of reading's client, devices only send it now and then so the last one is remembered
+func sensorConfig(reading *pb.Reading) *pb.SensorConfig {
+	sensorConfigMu.Lock()
+	defer sensorConfigMu.Unlock()
+	sensorCfg := reading.GetConfig()
+	if sensorCfg == nil {
+		return sensorConfigs[reading.ClientID]
+	}
+	if last := sensorConfigs[reading.ClientID]; !proto.Equal(last, sensorCfg) {
+		log.WithFields(log.Fields{
+			"ClientID":     reading.ClientID,
+			"SampleRateHz": sensorCfg.SampleRateHz,
+			"AccRangeG":    sensorCfg.AccRangeG,
+			"GyroRangeDps": sensorCfg.GyroRangeDps,
+			"Firmware":     sensorCfg.Firmware,
+		}).Info("Sensor config")
+	}
+	sensorConfigs[reading.ClientID] = sensorCfg
+	return sensorCfg
+}
+
+// checkSequence : Tracks seq of reading per client, returns false for a duplicate
+func checkSequence(reading *pb.Reading) bool {
+	event, skipped := seqTracker.Observe(reading.ClientID, reading.SeqEpoch, reading.Seq)
+	fields := log.Fields{
+		"ClientID": reading.ClientID,
+		"Seq":      reading.Seq,
+	}
+	switch event {
+	case sequence.Gap:
+		log.WithFields(fields).Warn("Missing ", skipped, " readings before this one")
+	case sequence.Restart:
+		log.WithFields(fields).Warn("Publisher restarted numbering, missing ", skipped, " readings before this one")
+	case sequence.Reordered:
+		log.WithFields(fields).Warn("Reading arrived out of order")
+	case sequence.Duplicate:
+		log.WithFields(fields).Warn("Duplicate reading dropped")
+		return false
+	}
+	return true
+}
 
-		switch reading.ClientID {
-		case "1":
-			file1.WriteString(out)
-			file1.Sync()
-
-		case "2":
-			file2.WriteString(out)
-			file2.Sync()
-		case "3":
-			file3.WriteString(out)
-			file3.Sync()
+// reportSequences : Logs sequence counters of every client
+func reportSequences() {
+	stats := seqTracker.Stats()
+	for _, clientID := range seqTracker.Clients() {
+		st := stats[clientID]
+		log.WithFields(log.Fields{
+			"ClientID":    clientID,
+			"Received":    st.Received,
+			"Missing":     st.Missing,
+			"Gaps":        st.Gaps,
+			"Duplicates":  st.Duplicates,
+			"Reordered":   st.Reordered,
+			"Restarts":    st.Restarts,
+			"Unsequenced": st.Unsequenced,
+		}).Info("Reading sequence")
+	}
+}
+
+// reportLatencies : Logs mean and max latency of each hop per client
+// BLE includes the difference between the device and DataPublisher clocks so only its changes are meaningful
+func reportLatencies() {
+	stats := latencies.Stats()
+	for _, clientID := range latencies.Clients() {
+		st := stats[clientID]
+		if st.BLE.Count == 0 && st.Gateway.Count == 0 && st.MQTT.Count == 0 {
+			continue // publisher predates device timestamps
 		}
+		log.WithFields(log.Fields{
+			"ClientID":    clientID,
+			"BLEMean":     st.BLE.Mean,
+			"BLEMax":      st.BLE.Max,
+			"GatewayMean": st.Gateway.Mean,
+			"GatewayMax":  st.Gateway.Max,
+			"MQTTMean":    st.MQTT.Mean,
+			"MQTTMax":     st.MQTT.Max,
+		}).Info("Reading latency")
 	}
-	file.WriteString(out)
-	file.Sync()
+}
 
+// seqReportRoutine : Logs sequence counters and latencies every interval
+func seqReportRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		reportSequences()
+		reportLatencies()
+	}
 }
 
+// calcRoutine : Collects start packets of each move window and reports sync delay once every dancer started,
+// or once syncTimeout passes since the first start packet, over the dancers that did arrive
+// Start packets are grouped by move window so packets from different moves are never mixed
 func calcRoutine() {
-	var Client1, Client2, Client3 startPacket
-	var syncDelay time.Duration
-	received := 0
+	var packets []startPacket
+	var deadline <-chan time.Time
+	moveID := 0
+	reported := 0
 	for {
 		select {
-		case pack := <-start:
-			received++
-			log.Info("Received start packet from ", pack.clientID)
-			if received == 1 {
-				Client1 = pack
+		case dw := <-start:
+			if dw.MoveID <= reported {
+				log.Warn("Late start packet from ", dw.ClientID, " for move ", dw.MoveID, ", sync delay already reported")
+				continue
 			}
-			if received == 2 {
-				Client2 = pack
-			}
-			if received == 3 {
-				Client3 = pack
-				packets := []startPacket{Client1, Client2, Client3}
-				sort.Slice(packets, func(i, j int) bool { return packets[i].timeStamp < packets[j].timeStamp })
-				log.Info("Calculating syncDelay...")
-				syncDelay = time.Unix(0, packets[2].timeStamp).Sub(time.Unix(0, packets[0].timeStamp))
-				log.Info(packets)
-				log.WithFields(log.Fields{
-					"Fastest":   packets[0].clientID,
-					"Slowest":   packets[2].clientID,
-					"SyncDelay": syncDelay,
-				}).Info("SyncDelay calculated")
-				msgChan <- message{msgType: "delay", data: fmt.Sprint(syncDelay.Seconds() * 1000.00), ts: fmt.Sprint(clock.Add(time.Since(clock) + offset).UnixNano())}
-
-				if ignore != "pos" {
-					log.Info("Scaling down posChanges values")
-					log.Info("Current |", packets[0].posChange, packets[1].posChange, packets[2].posChange)
-
-					packets[0].posChange = packets[0].posChange - 3
-					packets[1].posChange = packets[1].posChange - 3
-					packets[2].posChange = packets[2].posChange - 3
-
-					log.Info("Scaled |", packets[0].posChange, packets[1].posChange, packets[2].posChange)
-
-					msgChan <- message{
-						msgType:   "positions",
-						data:      fmt.Sprint(packets[0].dancerNo, packets[1].dancerNo, packets[2].dancerNo),    // one single string for all initial pos ie: 0 2 3
-						extraData: fmt.Sprint(packets[0].posChange, packets[1].posChange, packets[2].posChange), // one single string for all posChange ie: -1 0 1
-						cids:      fmt.Sprint(packets[0].clientID, " ", packets[1].clientID, " ", packets[2].clientID),
-						ts:        fmt.Sprint(clock.Add(time.Since(clock) + offset).UnixNano()),
-					}
+			if dw.MoveID != moveID {
+				if len(packets) > 0 {
+					log.Warn("Move ", dw.MoveID, " started before move ", moveID, " timed out")
+					reportSyncDelay(moveID, packets)
+					reported = moveID
 				}
-				received = 0
+				packets = nil
+				moveID = dw.MoveID
+				deadline = time.After(syncTimeout)
+			}
+			packets = append(packets, startPacket{clientID: dw.ClientID, timeStamp: dw.Start, dancerNo: dw.DancerNo, posChange: dw.PosChange})
+			log.Info("Received start packet from ", dw.ClientID, " for move ", dw.MoveID)
+			if len(packets) == dancers {
+				reportSyncDelay(moveID, packets)
+				reported = moveID
+				packets = nil
+				deadline = nil
 			}
+		case <-deadline:
+			log.Warn("Timed out waiting for start packets of move ", moveID)
+			reportSyncDelay(moveID, packets)
+			reported = moveID
+			packets = nil
+			deadline = nil
 		case <-calcDone:
 			return
 		}
 	}
 }
 
+// reportSyncDelay : Calculates sync delay between fastest and slowest of packets and posts it with positions to EvalClient
+func reportSyncDelay(moveID int, packets []startPacket) {
+	arrived := make(map[string]bool)
+	for _, pack := range packets {
+		arrived[pack.clientID] = true
+	}
+	var absent []string
+	for i := 1; i <= dancers; i++ {
+		if clientID := fmt.Sprint(i); !arrived[clientID] {
+			absent = append(absent, clientID)
+		}
+	}
+
+	sort.Slice(packets, func(i, j int) bool { return packets[i].timeStamp < packets[j].timeStamp })
+	fastest, slowest := packets[0], packets[len(packets)-1]
+	log.Info("Calculating syncDelay...")
+	syncDelay := time.Unix(0, slowest.timeStamp).Sub(time.Unix(0, fastest.timeStamp))
+	log.Info(packets)
+	log.WithFields(log.Fields{
+		"Move":      moveID,
+		"Fastest":   fastest.clientID,
+		"Slowest":   slowest.clientID,
+		"SyncDelay": syncDelay,
+		"Absent":    absent,
+	}).Info("SyncDelay calculated")
+	msgChan <- message{
+		path: evalapi.DelayPath,
+		body: evalapi.Delay{
+			Delay:  syncDelay.Seconds() * 1000.00,
+			Absent: absent,
+			Ts:     clock.Now().UnixNano(),
+		},
+	}
+
+	if ignore != "pos" {
+		pos := evalapi.Positions{
+			DancerNos: make([]int, len(packets)),
+			Changes:   make([]int, len(packets)),
+			ClientIDs: make([]string, len(packets)),
+			Ts:        clock.Now().UnixNano(),
+		}
+		log.Info("Scaling down posChanges values")
+		for i := range packets {
+			log.Info("Current | ", packets[i].clientID, " ", packets[i].posChange)
+			packets[i].posChange = packets[i].posChange - 3
+			log.Info("Scaled | ", packets[i].clientID, " ", packets[i].posChange)
+
+			pos.DancerNos[i] = int(packets[i].dancerNo)
+			pos.Changes[i] = int(packets[i].posChange)
+			pos.ClientIDs[i] = packets[i].clientID
+		}
+
+		msgChan <- message{path: evalapi.PositionsPath, body: pos}
+	}
+}
+
+// tickRoutine : Closes timed out move windows
+// Runs apart from segmentRoutine as Tick blocks until the closed window is received from windows
+func tickRoutine() {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		segmenter.Tick(now)
+	}
+}
+
+// segmentRoutine : Logs every closed move window
+func segmentRoutine() {
+	for mw := range windows {
+		fields := log.Fields{
+			"Move":     mw.ID,
+			"Dancers":  len(mw.Dancers),
+			"TimedOut": mw.TimedOut,
+		}
+		for _, dw := range mw.Dancers {
+			window := "no idle packet"
+			if dw.End != 0 {
+				window = time.Duration(dw.End - dw.Start).String()
+			}
+			fields["Dancer "+dw.ClientID] = window
+		}
+		log.WithFields(fields).Info("Move window closed")
+	}
+}
+
 func postData() {
 	defer close(msgChan)
 	for {
 		select {
 		case msg := <-msgChan:
-			var reqBody []byte
-			var err error
-			if msg.msgType == "positions" {
-				reqBody, err = json.Marshal(map[string]string{
-					"dancerNo": msg.data,
-					"changes":  msg.extraData,
-					"cids":     msg.cids,
-					"ts":       msg.ts,
-				})
-			} else {
-				reqBody, err = json.Marshal(map[string]string{
-					msg.msgType: msg.data,
-					"ts":        msg.ts,
-				})
+			reqBody, err := json.Marshal(msg.body)
+			if err != nil {
+				log.Error(err)
+				continue
 			}
-
+			url := cfg.EvalClient + msg.path
+			resp, err := http.Post(url,
+				"application/json", bytes.NewBuffer(reqBody))
+			if err != nil {
+				log.Error(err)
+				log.Error("Could not post to EvalClient on ", cfg.EvalClient, " but continuing silently")
+				continue
+			}
+			respBody, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
 			if err != nil {
 				log.Error(err)
+			} else if resp.StatusCode != http.StatusOK {
+				log.Error("EvalClient rejected ", msg.path, " | ", resp.Status, " ", string(respBody))
 			} else {
-				url := evalClientConn + "/" + msg.msgType
-				resp, err := http.Post(url,
-					"application/json", bytes.NewBuffer(reqBody))
-				if err != nil {
-					log.Error(err)
-					log.Error("Could not post to EvalClient on ", evalClientConn, " but continuing silently")
-				} else {
-					defer resp.Body.Close()
-					respBody, err := ioutil.ReadAll(resp.Body)
-					if err != nil {
-						log.Error(err)
-					} else {
-						log.Info("Response body | ", string(respBody))
-					}
-				}
+				log.Info("Response body | ", string(respBody))
 			}
 		}
 	}
 }
 
+// dialAddr : Returns host:port to reach a listener bound to addr, loopback if it is bound to all interfaces
+func dialAddr(addr *net.TCPAddr) string {
+	host := "127.0.0.1"
+	if addr.IP != nil && !addr.IP.IsUnspecified() {
+		host = addr.IP.String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+// transport : Returns how the MQTT client reaches brokerURL, for logging
+func transport(brokerURL string) string {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return "unknown transport"
+	}
+	switch u.Scheme {
+	case "ssl", "tls", "tcps", "mqtts":
+		return "TLS"
+	case "ws":
+		return "WebSocket"
+	case "wss":
+		return "WebSocket over TLS"
+	default:
+		return "plain TCP"
+	}
+}
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 	flag.StringVar(&cid, "cid", "lapis-client-sub-"+fmt.Sprint(rand.Intn(1000)), "If not provided, defaults to lapis-client-sub-X where X is a random int between 1 & 1000")
 	flag.StringVar(&mode, "mode", "single", "Enter mode: single or multi, defaults to single. Single mode will not perform position nor latency calculation")
-	flag.StringVar(&evalClientConn, "evalclientconn", "http://127.0.0.1:10202", "please enter http://<ip>:<port> of evalclient httpserver, for example: -evalclientconn=http://127.0.0.1:10202")
+	loader = config.NewLoader(flag.CommandLine, config.Default(), config.Broker, config.MQTTUser, config.MQTTPassword, config.BrokerCA, config.EvalClient,
+		config.StartQoS, config.DataQoS, config.Persistent, config.NTPServers, config.NTPResync)
+	flag.IntVar(&dancers, "dancers", 3, "Enter number of dancers between 2 and 8, defaults to 3")
+	flag.StringVar(&embedBroker, "embedbroker", "", "Optional, starts an in-process MQTT broker on this address and subscribes through it, for example: -embedbroker=:1883")
+	flag.DurationVar(&moveTimeout, "movetimeout", 10*time.Second, "Max duration of a move window, windows still open after this are closed even if idle packets are missing")
+	flag.DurationVar(&syncTimeout, "synctimeout", 2*time.Second, "Max wait for start packets of all dancers after the first one, sync delay is then reported over the dancers that arrived")
 	flag.StringVar(&ignore, "ignore", "none", "Enter ignore: pos, defaults to none. pos will not calculate positions")
+	flag.DurationVar(&seqReport, "seqreport", time.Minute, "Interval between logs of missing, duplicate and reordered readings and latencies per client, 0 to only log them on exit")
 	//log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
@@ -313,26 +482,52 @@ func main() {
 	go handleSignals(signalChan, done)
 
 	flag.Parse()
-	log.Info("Starting in " + mode + " mode")
+	if err := position.ValidateDancers(dancers); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Info("Starting in "+mode+" mode with ", dancers, " dancers")
 	log.Info("Ignoring | " + ignore)
 	log.Info("Starting NTPClient to get offset")
 
-	clockOffset, err := ntp.Offset()
-	if err != nil {
-		log.Error(err.Error())
+	ntpClient := &ntp.Client{Servers: cfg.NTP.Servers, Samples: cfg.NTP.Samples}
+	clockSync = ntpClient.StartResync(cfg.NTP.Resync, clock.Update)
+	if sample, ok, err := clockSync.Last(); ok {
+		log.Info("NTP Server:", sample.Server, " Delay:", sample.Delay)
+	} else {
+		log.Error("NTP sync failed, using system clock | ", err)
 	}
-	offset = clockOffset
 
-	log.Info("NTP Offset:", offset)
-	log.Info("NTP Clock:", clock.Add(time.Since(clock)+offset))
+	log.Info("NTP Offset:", clock.Offset(), " Uncertainty:", clock.Uncertainty())
+	log.Info("NTP Clock:", clock.Now())
 
 	var ClientID = cid
-	const BrokerConfig = "ssl://mqtts.qz.sg:8883"
+	var BrokerConfig = cfg.Broker.URL
+	if embedBroker != "" {
+		b := broker.New(broker.Options{Username: cfg.Broker.Username, Password: cfg.Broker.Password})
+		defer b.Close()
+		listener, err := net.Listen("tcp", embedBroker)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go b.Serve(listener)
+		BrokerConfig = "tcp://" + dialAddr(listener.Addr().(*net.TCPAddr))
+	}
 
 	if mode != "single" {
+		segmenter = segment.New(dancers, moveTimeout, start, windows)
+		go tickRoutine()
+		go segmentRoutine()
 		go calcRoutine()
 		go postData()
 	}
+	if seqReport > 0 {
+		go seqReportRoutine(seqReport)
+	}
 
 	file, err = os.OpenFile("reading.csv", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
@@ -340,46 +535,52 @@ func main() {
 	}
 	defer file.Close()
 	if mode != "single" {
-		file1, err = os.OpenFile("reading_1.csv", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-		if err != nil {
-			log.Panic(err)
-		}
-		defer file1.Close()
-		file2, err = os.OpenFile("reading_2.csv", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-		if err != nil {
-			log.Panic(err)
-		}
-		defer file2.Close()
-		file3, err = os.OpenFile("reading_3.csv", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
-		if err != nil {
-			log.Panic(err)
+		for i := 1; i <= dancers; i++ {
+			clientID := fmt.Sprint(i)
+			dancerFile, err := os.OpenFile("reading_"+clientID+".csv", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				log.Panic(err)
+			}
+			defer dancerFile.Close()
+			dancerFiles[clientID] = dancerFile
 		}
-		defer file3.Close()
 	}
 
 	log.Info("Connecting to " + BrokerConfig + " with ClientID " + ClientID)
 
-	tlsConfig := &tls.Config{
-		//Go will dig out and use the System RootCA cert set if nothing is passed in
-		ClientAuth: tls.NoClientCert, //we do not use client certs for auth
-		ClientCAs:  nil,
+	tlsConfig, err := cfg.Broker.TLSConfig()
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	opts := mqtt.NewClientOptions().AddBroker(BrokerConfig).SetClientID(ClientID)
 	opts.SetTLSConfig(tlsConfig)
-	opts.SetUsername("xilinx")
-	opts.SetPassword("undecimus")
+	opts.SetUsername(cfg.Broker.Username)
+	opts.SetPassword(cfg.Broker.Password)
 	opts.SetDefaultPublishHandler(f)
-	topic := "sensor/+/data"
-
+	if cfg.Broker.Persistent {
+		// Broker keeps subscriptions and queues QoS 1/2 messages for this client id while disconnected
+		cidSet := false
+		flag.Visit(func(fl *flag.Flag) { cidSet = cidSet || fl.Name == "cid" })
+		if !cidSet {
+			log.Warn("Persistent session requested without -cid, session cannot be resumed after a restart")
+		}
+		opts.SetCleanSession(false)
+		log.Info("Using persistent MQTT session")
+	}
 	client := mqtt.NewClient(opts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		log.Panic(token.Error())
 	} else {
-		log.Infoln("Connected to MQTT Broker over TLS")
+		log.Infoln("Connected to MQTT Broker over", transport(BrokerConfig))
 	}
 
-	if token := client.Subscribe(topic, 0, nil); token.Wait() && token.Error() != nil {
+	// Single readings and batches are both accepted so publishers can be switched to batching one at a time
+	topics := map[string]byte{
+		readingTopic: cfg.Broker.SubscribeQoS(),
+		batchTopic:   cfg.Broker.SubscribeQoS(),
+	}
+	if token := client.SubscribeMultiple(topics, nil); token.Wait() && token.Error() != nil {
 		log.Error(token.Error())
 		os.Exit(1)
 	}
@@ -1,383 +1,310 @@
 package main
 
 import (
-	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	"encoding/base64"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"math/rand"
-	"net"
 	"net/http"
 	"os"
-	"sort"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
-	"unicode"
 
+	"github.com/QzSG/lapis-uno/cmd/internal/codec"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	"github.com/QzSG/lapis-uno/cmd/internal/dashboard"
+	"github.com/QzSG/lapis-uno/cmd/internal/evalapi"
+	"github.com/QzSG/lapis-uno/cmd/internal/evalconn"
+	"github.com/QzSG/lapis-uno/cmd/internal/position"
+	"github.com/QzSG/lapis-uno/cmd/internal/vote"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
 	log "github.com/sirupsen/logrus"
 )
 
-const key = "testtesttesttest"
+// Dashboard push endpoints, only served if the ws or sse sink is configured
+const (
+	dashWSPath  = "/dashboard/ws"
+	dashSSEPath = "/dashboard/events"
+)
 
 var (
-	dataChannel      = make(chan []byte)
-	connectionString string
-	dashConnString   string
-	mode             string
-
-	posChan   = make(chan posBody)
-	moveChan  = make(chan moveBody)
-	delayChan = make(chan string)
+	dataChannel    chan []byte // messages queued for the eval server
+	queueSize      int
+	mode           string
+	dancers        int
+	policyString   string
+	tieBreakString string
+	strategyString string
+	policy         position.Policy
+	tieBreak       vote.TieBreak
+	strategy       vote.Strategy
+	roundTimeout   time.Duration
+
+	loader     *config.Loader
+	cfg        *config.Config
+	evalCodec  codec.Cipher
+	evalClient *evalconn.Client
+	dash       *dashboard.Dispatcher
+	dashQueue  int
+	dashFlush  = 2 * time.Second // max wait on exit for queued dashboard updates
+
+	posChan   = make(chan evalapi.Positions)
+	moveChan  = make(chan evalapi.Move)
+	delayChan = make(chan evalapi.Delay)
 
 	recvDelay = "0"
 
-	correctPos string              // correct positions returns by eval server, read only
-	calcPos    = "1 2 3"           // calculated positions
-	places     = make(map[int]int) //places[1] returns dancer number in left move pos, currently unused
+	correctPosChan = make(chan string)
 
-	dancerNoToPlace = make(map[int]int) //tracks dancerno to place
+	calcPos string // calculated positions
 )
 
-type moveBody struct {
-	Move string
-	Ts   string
-	Cid  string
-}
-
-type delayBody struct {
-	Delay string
-	Ts    string
-}
-
-type posBody struct {
-	DancerNo string
-	Changes  string
-	Cids     string
-	Ts       string
+// AESEncrypt : Encrypts data with the configured cipher mode
+// cbc returns base64(IV | ciphertext), gcm returns base64(version | nonce | ciphertext | tag)
+func AESEncrypt(data []byte) ([]byte, error) {
+	msg, err := evalCodec.Encrypt(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(msg), nil
 }
 
-type posStruct struct {
-	dancerNo int
-	change   int
-	cid      string
+func clientStart() {
+	log.Info("Lapis Comms Client Starting...")
+	evalClient = evalconn.New(cfg.EvalServer, dancers, dataChannel, correctPosChan)
+	evalClient.Start()
 }
 
-// Client : TCP Client
-type Client struct {
-	sock net.Conn
+// queueMessage : Queues msg for the eval server, dropped in standalone mode
+func queueMessage(msg []byte) {
+	if evalClient == nil {
+		return
+	}
+	evalClient.Queue(msg)
 }
 
-func (client *Client) recv() {
-	for {
-		msg := make([]byte, 8)
-		len, err := client.sock.Read(msg)
+// openDashboard : Starts a retrying sink for each configured dashboard sink, ws and sse are served by the httpserver
+func openDashboard() error {
+	dash = dashboard.NewDispatcher()
+	var hub *dashboard.Hub
+	seen := make(map[dashboard.Kind]bool)
+	for _, name := range cfg.DashboardSinks {
+		kind, err := dashboard.ParseKind(name)
 		if err != nil {
-			client.sock.Close()
-			break
+			return err
 		}
-		if len > 0 {
-			fmt.Println("RECEIVED: " + string(msg))
-
-			correctPos = strings.TrimRightFunc(string(msg), func(r rune) bool {
-				return !unicode.IsPrint(r)
-			})
-
-			if calcPos != correctPos {
-				log.Info("Calculated postiions were incorrect")
-
-				positions := strings.Split(correctPos, " ")
-
-				for i, dNoStr := range positions {
-					dNo, _ := strconv.Atoi(dNoStr)
-					dancerNoToPlace[dNo] = i + 1
-				}
-				calcPos = correctPos
+		if seen[kind] {
+			continue
+		}
+		seen[kind] = true
 
-				log.Info("Positions updated to |", calcPos)
+		switch kind {
+		case dashboard.HTTPKind:
+			dash.Add("http "+cfg.Dashboard, dashboard.NewHTTPSink(cfg.Dashboard), dashQueue)
+		case dashboard.FileKind:
+			sink, err := dashboard.NewFileSink(cfg.DashboardFile)
+			if err != nil {
+				return err
+			}
+			dash.Add("file "+cfg.DashboardFile, sink, dashQueue)
+		case dashboard.MQTTKind:
+			tlsConfig := &tls.Config{
+				ClientAuth: tls.NoClientCert,
+				ClientCAs:  nil,
+			}
+			opts := mqtt.NewClientOptions().AddBroker(cfg.Broker.URL).SetClientID(fmt.Sprint("lapis-dashboard-", os.Getpid()))
+			opts.SetTLSConfig(tlsConfig)
+			opts.SetUsername(cfg.Broker.Username)
+			opts.SetPassword(cfg.Broker.Password)
+			dash.Add("mqtt "+cfg.DashboardTopic, dashboard.NewMQTTSink(opts, cfg.DashboardTopic), dashQueue)
+		case dashboard.WebSocketKind, dashboard.SSEKind:
+			if hub == nil {
+				hub = dashboard.NewHub(dashQueue) // replays up to dashQueue updates to reconnecting clients
+				dash.Add("push", hub, dashQueue)
+			}
+			if kind == dashboard.WebSocketKind {
+				http.Handle(dashWSPath, hub.WebSocketHandler(append([]string{cfg.Dashboard}, cfg.DashboardOrigins...)))
+			} else {
+				http.HandleFunc(dashSSEPath, hub.ServeSSE)
 			}
 		}
+		log.Info("Dashboard sink | ", kind)
 	}
+	return nil
 }
 
-func (client *Client) send() {
-	defer client.sock.Close()
-	for {
-		select {
-		case message, ok := <-dataChannel:
-			if !ok {
-				return
-			}
-			(*client).sock.Write(message)
+// changesFrom : Converts validated position changes for the tracker
+func changesFrom(pos evalapi.Positions) []position.Change {
+	changes := make([]position.Change, len(pos.Changes))
+	for i := range pos.Changes {
+		changes[i] = position.Change{DancerNo: pos.DancerNos[i], Change: pos.Changes[i]}
+		if i < len(pos.ClientIDs) {
+			changes[i].ClientID = pos.ClientIDs[i]
 		}
 	}
+	return changes
 }
 
-func encode(bytes []byte) string {
-	return base64.StdEncoding.EncodeToString(bytes)
-}
-
-// Pad : Whitespace Padding
-func Pad(srcBytes []byte, blockSize int) []byte {
-	padding := blockSize - len(srcBytes)%blockSize
-	padtext := bytes.Repeat([]byte{32}, padding)
-	return append(srcBytes, padtext...)
-}
-
-func generateIV() []byte {
-	iv := make([]byte, 16)
+// submitRound : Sends the move chosen for a closed round to the eval server and dashboard
+func submitRound(r vote.Round) {
+	decision := vote.Decide(r, strategy, tieBreak)
+	confMove := decision.Move
+	log.WithFields(log.Fields{
+		"Round":    r.ID,
+		"Strategy": decision.Strategy,
+		"Score":    decision.Score,
+		"Tied":     decision.Tied,
+		"Votes":    len(r.Votes),
+	}).Info("Chosen move | ", confMove)
+
+	data := "#" + calcPos + "|" + confMove + "|" + recvDelay
+	log.Info("Sending | ", data)
 
-	if _, err := rand.Read(iv); err != nil {
-		log.Error("Error occured generating IV")
+	if mode != "standalone" {
+		msg, err := AESEncrypt([]byte(data))
+		if err != nil {
+			log.Error("Failed to encrypt | ", err)
+		} else {
+			queueMessage(msg)
+		}
 	}
 
-	return iv
-}
-
-// AESEncrypt : Encrypt data with AES-128-CBC
-func AESEncrypt(data []byte) string {
-	iv := generateIV()
-	ciph, err := aes.NewCipher([]byte(key))
-	if err != nil {
-		log.Error("Error with the key: ", err)
+	recvMoves := r.Moves()
+	dancerMoves := make([]string, dancers)
+	for i := range dancerMoves {
+		dancerMoves[i] = recvMoves[fmt.Sprint(i+1)]
 	}
-	encrypter := cipher.NewCBCEncrypter(ciph, iv)
-	ciphertext := make([]byte, len(data))
-	encrypter.CryptBlocks(ciphertext, data)
-
-	ivData := append(iv, ciphertext...)
-	return encode(ivData)
-}
-
-func clientStart() { //Client {
-	log.Info("Lapis Comms Client Starting...")
-	conn, err := net.Dial("tcp", connectionString)
-	if err != nil {
-		log.Fatal(err)
-	} else {
-		log.Info("Lapis Comms Client connected.")
-	}
-	client := &Client{sock: conn}
-	go client.recv()
-	go client.send()
-}
-
-// MoveCount :
-type MoveCount struct {
-	move  string
-	count int
+	u := dash.Publish(dashboard.Update{
+		Data:     fmt.Sprint(data, "|", strings.Join(dancerMoves, " ")),
+		Round:    r.ID,
+		Strategy: string(decision.Strategy),
+		Score:    decision.Score,
+		Tied:     decision.Tied,
+	})
+	log.Info("Dashboard update ", u.Seq, " | ", u.Data)
 }
 
 func updateRoutine() {
-	var move1, move2, move3 string
-	moveCount := 0
-	allDancersIdentified := false
+	tracker := position.NewPositionTracker(dancers, position.RandomResolver)
 
-	recvMoves := make(map[string]string)
+	clientIDs := make([]string, dancers)
+	for i := range clientIDs {
+		clientIDs[i] = fmt.Sprint(i + 1)
+	}
+	aggregator := vote.NewAggregator(clientIDs, roundTimeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
 
-	m := make(map[string]int)
 	for {
 		select {
-		case movebody := <-moveChan:
-			moveCount++
-			recvMoves[movebody.Cid] = movebody.Move
-			switch moveCount {
-			case 1:
-				move1 = movebody.Move
-			case 2:
-				move2 = movebody.Move
-			case 3:
-				move3 = movebody.Move
-				moves := []string{move1, move2, move3}
-				for _, mv := range moves {
-					if _, ok := m[mv]; ok {
-						m[mv]++
-					} else {
-						m[mv] = 1
-					}
-				}
-
-				moveCounts := make([]MoveCount, 0, len(m))
-				for key, val := range m {
-					moveCounts = append(moveCounts, MoveCount{move: key, count: val})
-				}
-
-				// sort wordCount slice by decreasing count number
-				sort.Slice(moveCounts, func(i, j int) bool {
-					return moveCounts[i].count > moveCounts[j].count
-				})
-
-				log.Info("Modal move | ", moveCounts[0].move, " | ", moveCounts[0].count)
-
-				confMove := moveCounts[0].move
-				data := "#" + calcPos + "|" + confMove + "|" + recvDelay
-				log.Info("Sending | ", data)
-
-				if mode != "standalone" {
-					dataChannel <- []byte(AESEncrypt(Pad([]byte(data), aes.BlockSize)))
-				}
-				m = make(map[string]int)
-				moveCount = 0
-
-				go func(recvMoves map[string]string) {
-
-					postBody := fmt.Sprint(data, "|", recvMoves["1"], " ", recvMoves["2"], " ", recvMoves["3"])
-					reqBody, err := json.Marshal(map[string]string{
-						"data": postBody,
-					})
-					log.Info("Posting | ", string(reqBody))
-					if err != nil {
-						log.Error(err)
-					} else {
-						resp, err := http.Post(dashConnString,
-							"application/json", bytes.NewBuffer(reqBody))
-						if err != nil {
-							log.Error(err)
-							log.Error("Could not post to dashconnection on ", dashConnString, " but continuing silently")
-						} else {
-							defer resp.Body.Close()
-							respBody, err := ioutil.ReadAll(resp.Body)
-							if err != nil {
-								log.Error(err)
-							} else {
-								log.Info(string(respBody))
-							}
-						}
-					}
-				}(recvMoves)
+		case move := <-moveChan:
+			r, err := aggregator.Add(move.MoveID, move.ClientID, move.Move, move.GetConfidence(), time.Now())
+			if err != nil {
+				log.Warn(err)
+				break
 			}
-		case pos := <-posChan:
-
-			places[1] = 0
-			places[2] = 0
-			places[3] = 0
-
-			changes := strings.Split(pos.Changes, " ")
-			s1, _ := strconv.Atoi(changes[0])
-			s2, _ := strconv.Atoi(changes[1])
-			s3, _ := strconv.Atoi(changes[2])
-
-			clientids := strings.Split(pos.Cids, " ")
-			log.Info("clientids | ", clientids)
-			c1 := clientids[0]
-			c3 := clientids[1]
-			c2 := clientids[2]
-
-			dancerNo := strings.Split(pos.DancerNo, " ")
-			d1, _ := strconv.Atoi(dancerNo[0])
-			d2, _ := strconv.Atoi(dancerNo[1])
-			d3, _ := strconv.Atoi(dancerNo[2])
-
-			posPack1 := posStruct{dancerNo: d1, change: s1, cid: c1}
-			posPack2 := posStruct{dancerNo: d2, change: s2, cid: c2}
-			posPack3 := posStruct{dancerNo: d3, change: s3, cid: c3}
-			packets := []posStruct{posPack1, posPack2, posPack3}
-			sort.Slice(packets, func(i, j int) bool { return packets[i].dancerNo < packets[j].dancerNo })
-
-			posPack1 = packets[0]
-			posPack2 = packets[1]
-			posPack3 = packets[2]
-
-			if !allDancersIdentified {
-				dancerNoToPlace[1] = 1
-				dancerNoToPlace[2] = 2
-				dancerNoToPlace[3] = 3
-				allDancersIdentified = true
+			if r != nil {
+				submitRound(*r)
 			}
-
-			// statuses
-			// -2 = 2x left
-			// -1 = left
-			// 0  = stay
-			// 1  = right
-			// 2  = 2x right
-
-			sumChange := posPack1.change + posPack2.change + posPack3.change
-
+		case now := <-ticker.C:
+			for _, r := range aggregator.Tick(now) {
+				log.Warn("Round ", r.ID, " timed out without moves from | ", strings.Join(r.Missing, " "))
+				submitRound(r)
+			}
+		case pos := <-posChan:
+			changes := changesFrom(pos)
+			log.Info("clientids | ", pos.ClientIDs)
 			log.Info("currPos | ", calcPos)
 
 			// The sums of posChanges should always be 0 regardless of postiion changes, otherwise there is an error in calculating posChange
-			if sumChange == 0 {
-
-				tempPos1 := dancerNoToPlace[1] + posPack1.change
-				tempPos2 := dancerNoToPlace[2] + posPack2.change
-				tempPos3 := dancerNoToPlace[3] + posPack3.change
-
-				count := make(map[int]int)
-
-				validPos := []bool{false, false, false}
-				var invalidDancers []int
-				invalidCount := 0
-
-				if tempPos1 > 0 && tempPos1 < 4 {
-					validPos[0] = true
-					dancerNoToPlace[1] = tempPos1
-				}
-				if tempPos2 > 0 && tempPos2 < 4 {
-					validPos[1] = true
-					dancerNoToPlace[2] = tempPos2
-				}
-				if tempPos3 > 0 && tempPos3 < 4 {
-					validPos[2] = true
-					dancerNoToPlace[3] = tempPos3
-				}
+			if position.SumChanges(changes) != 0 {
+				log.Warn("Sum of position changes is non ZERO, error in posChange detection from one or more devices")
 
-				for dNo, place := range dancerNoToPlace {
-					if count[place] == 0 {
-						count[place] = count[place] + 1
-						if validPos[dNo-1] {
-							places[place] = dNo
-						} else {
-							invalidDancers = append(invalidDancers, dNo)
-							invalidCount++
-						}
+				switch policy {
+				case position.StrictPolicy:
+					log.Info("Calculating random positions")
+					tracker.Shuffle()
+					calcPos = tracker.String()
+					log.Info("Random CalcPos | ", calcPos)
+					continue
+				case position.RepairPolicy:
+					repaired, ok := position.Repair(changes)
+					if ok {
+						log.Info("Repaired position changes | ", repaired)
 					} else {
-						invalidDancers = append(invalidDancers, dNo)
-						invalidCount++
+						log.Warn("Could not repair position changes, applying as is")
 					}
+					changes = repaired
 				}
+			}
 
-				log.Info("invalidDancers | ", invalidDancers)
-
-				if invalidCount > 0 {
-					rand.Shuffle(len(invalidDancers), func(i, j int) { invalidDancers[i], invalidDancers[j] = invalidDancers[j], invalidDancers[i] })
+			tracker.Apply(changes)
+			calcPos = tracker.String()
+			log.Info("CalcPos | ", calcPos)
 
-					ptr := 0
-					for x, dancer := range places {
-						if dancer == 0 {
-							places[x] = invalidDancers[ptr]
-							dancerNoToPlace[invalidDancers[ptr]] = x
-							ptr++
-						}
+		case correctPos := <-correctPosChan:
+			if calcPos != correctPos {
+				log.Info("Calculated postiions were incorrect")
 
-					}
+				positions, err := position.ParsePositions(correctPos)
+				if err == nil {
+					err = tracker.Reset(positions)
 				}
-
-				calcPos = fmt.Sprint(places[1], places[2], places[3])
-				log.Info("CalcPos | ", calcPos)
-			} else {
-				log.Warn("Sum of position changes is non ZERO, error in posChange detection from one or more devices")
-				log.Info("Calculating random positions")
-				random := []int{1, 2, 3}
-				rand.Shuffle(len(random), func(i, j int) { random[i], random[j] = random[j], random[i] })
-				calcPos = fmt.Sprint(random[0], random[1], random[2])
-				for i, dNo := range random {
-					dancerNoToPlace[dNo] = i + 1
+				if err != nil {
+					log.Error("Error applying correct positions | ", err)
+					break
 				}
-				log.Info("Random CalcPos | ", calcPos)
+				calcPos = tracker.String()
+
+				log.Info("Positions updated to |", calcPos)
 			}
 
 		case delay := <-delayChan:
-			recvDelay = delay
+			recvDelay = strconv.FormatFloat(delay.Delay, 'f', -1, 64)
 		}
 	}
 }
 
+func acceptMove(move evalapi.Move) {
+	log.Info("Recv move | ", move.ClientID, " ", move.Move, " | round ", move.MoveID)
+	moveChan <- move
+}
+
+func acceptDelay(delay evalapi.Delay) {
+	log.Info("Recv delay | ", delay.Delay)
+	if len(delay.Absent) > 0 {
+		log.Warn("Delay calculated without dancers | ", delay.Absent)
+	}
+	delayChan <- delay // Blocking send to delayChan (Should be fine as estimated 1 post / sec)
+}
+
+func acceptPositions(pos evalapi.Positions) {
+	log.Info("Recv cids | ", pos.ClientIDs)
+	log.Info("Recv position changes | ", pos.Changes)
+	posChan <- pos
+}
+
+func healthHandler(w http.ResponseWriter, req *http.Request) {
+	status := evalconn.Status{}
+	if evalClient != nil {
+		status = evalClient.Status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if evalClient != nil && !status.Connected {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"mode":       mode,
+		"evalServer": status,
+		"dashboard":  dash.Status(),
+	})
+}
+
 func startHTTPServer() {
 	requestHandler := func(w http.ResponseWriter, req *http.Request) {
 		if req.URL.Path == "/" {
@@ -392,117 +319,195 @@ func startHTTPServer() {
 
 			data := body
 
-			dataChannel <- []byte(AESEncrypt(Pad([]byte(data), aes.BlockSize)))
-
-			reqBody, err := json.Marshal(map[string]string{
-				"data": string(data),
-			})
-
+			msg, err := AESEncrypt(data)
 			if err != nil {
-				log.Error(err)
+				log.Error("Failed to encrypt | ", err)
 			} else {
-				resp, err := http.Post(dashConnString,
-					"application/json", bytes.NewBuffer(reqBody))
-				if err != nil {
-					log.Error(err)
-					log.Error("Could not post to dashconnection on ", dashConnString, " but continuing silently")
-				} else {
-					defer resp.Body.Close()
-					respBody, err := ioutil.ReadAll(resp.Body)
-					if err != nil {
-						log.Error(err)
-					} else {
-						log.Info(string(respBody))
-					}
-				}
+				queueMessage(msg)
 			}
 
+			dash.Publish(dashboard.Update{Data: string(data)})
 		}
 
 	}
 
-	moveHandler := func(w http.ResponseWriter, req *http.Request) {
-		body, err := ioutil.ReadAll(req.Body)
+	// Legacy endpoints take string fields, Decode converts them into v2 bodies
+
+	legacyMoveHandler := func(w http.ResponseWriter, req *http.Request) {
+		body, err := evalapi.Decode(w, req, &evalapi.LegacyMove{}, dancers, false)
 		if err != nil {
-			log.Printf("Error reading body: %v", err)
-			http.Error(w, "bad", http.StatusBadRequest)
+			log.Warn("Rejected move | ", err)
+			evalapi.WriteError(w, err)
 			return
 		}
+		move := body.(evalapi.Move)
 		io.WriteString(w, "ok")
+		acceptMove(move)
+	}
 
-		var moveBod = moveBody{}
-		err = json.Unmarshal(body, &moveBod)
+	legacyDelayHandler := func(w http.ResponseWriter, req *http.Request) {
+		body, err := evalapi.Decode(w, req, &evalapi.LegacyDelay{}, dancers, false)
 		if err != nil {
-			log.Error("Error unmarshaling move json")
+			log.Warn("Rejected delay | ", err)
+			evalapi.WriteError(w, err)
+			return
 		}
-		moveChan <- moveBod
-		log.Info("Recv move | ", moveBod.Move)
+		delay := body.(evalapi.Delay)
+		io.WriteString(w, "ok")
+		acceptDelay(delay)
 	}
 
-	delayHandler := func(w http.ResponseWriter, req *http.Request) {
-		body, err := ioutil.ReadAll(req.Body)
+	legacyPosHandler := func(w http.ResponseWriter, req *http.Request) {
+		body, err := evalapi.Decode(w, req, &evalapi.LegacyPositions{}, dancers, false)
 		if err != nil {
-			log.Printf("Error reading body: %v", err)
-			http.Error(w, "bad", http.StatusBadRequest)
+			log.Warn("Rejected positions | ", err)
+			evalapi.WriteError(w, err)
 			return
 		}
+		pos := body.(evalapi.Positions)
 		io.WriteString(w, "ok")
-		var delayBod = delayBody{}
-		err = json.Unmarshal(body, &delayBod)
-		if err != nil {
-			log.Error("Error unmarshaling delay json")
-		}
-		log.Info("Recv delay | ", delayBod.Delay)
-		delayChan <- delayBod.Delay // Blocking send to delayChan (Should be fine as estimated 1 post / sec)
-
+		acceptPositions(pos)
 	}
 
-	posHandler := func(w http.ResponseWriter, req *http.Request) {
-		body, err := ioutil.ReadAll(req.Body)
-		if err != nil {
-			log.Printf("Error reading body: %v", err)
-			http.Error(w, "bad", http.StatusBadRequest)
+	moveHandler := func(w http.ResponseWriter, req *http.Request) {
+		var move evalapi.Move
+		if _, err := evalapi.Decode(w, req, &move, dancers, true); err != nil {
+			log.Warn("Rejected move | ", err)
+			evalapi.WriteError(w, err)
 			return
 		}
-		io.WriteString(w, "ok")
+		evalapi.WriteOK(w)
+		acceptMove(move)
+	}
 
-		var posBod = posBody{}
-		err = json.Unmarshal(body, &posBod)
-		if err != nil {
-			log.Error("Error unmarshaling position json")
+	delayHandler := func(w http.ResponseWriter, req *http.Request) {
+		var delay evalapi.Delay
+		if _, err := evalapi.Decode(w, req, &delay, dancers, true); err != nil {
+			log.Warn("Rejected delay | ", err)
+			evalapi.WriteError(w, err)
+			return
 		}
-		log.Info("Recv cids | ", posBod.Cids)
-		log.Info("Recv position changes | ", posBod.Changes)
+		evalapi.WriteOK(w)
+		acceptDelay(delay)
+	}
 
-		posChan <- posBod
+	posHandler := func(w http.ResponseWriter, req *http.Request) {
+		var pos evalapi.Positions
+		if _, err := evalapi.Decode(w, req, &pos, dancers, true); err != nil {
+			log.Warn("Rejected positions | ", err)
+			evalapi.WriteError(w, err)
+			return
+		}
+		evalapi.WriteOK(w)
+		acceptPositions(pos)
 	}
 
 	if mode != "single" {
-		http.HandleFunc("/delay", delayHandler)   // For receiving syncdelay in seconds ex 3.141 between fastest & slowest dancer from DataSub using HTTP Post
-		http.HandleFunc("/positions", posHandler) // For receiving positions data using HTTP Post
-		http.HandleFunc("/move", moveHandler)     // For receiving move ex: rocket , currently needs to receive three times for multi dancer
+		http.HandleFunc(evalapi.DelayPath, delayHandler)   // Sync delay in milliseconds between fastest & slowest dancer from DataSub
+		http.HandleFunc(evalapi.PositionsPath, posHandler) // Position changes from DataSub
+		http.HandleFunc(evalapi.MovePath, moveHandler)     // Move of a single dancer, needs one per dancer
+
+		http.HandleFunc("/delay", legacyDelayHandler)   // Legacy unversioned delay with string fields, adapted into /v2/delay
+		http.HandleFunc("/positions", legacyPosHandler) // Legacy unversioned positions with space separated string fields, adapted into /v2/positions
+		http.HandleFunc("/move", legacyMoveHandler)     // Legacy unversioned move with string fields, adapted into /v2/move
 	}
+	http.HandleFunc("/health", healthHandler) // Eval server connection and dashboard delivery status as json, 503 while disconnected from the eval server
 	go updateRoutine()
 	http.HandleFunc("/", requestHandler) // For receiving full string ex: #1 2 3|rocket|0.123 , only used for single dancer , To be migrated to /move
 	log.Fatal(http.ListenAndServe("127.0.0.1:10202", nil))
 }
 
 func init() {
-	flag.StringVar(&connectionString, "conn", "127.0.0.1:12345", "please enter <ip>:<port> of eval server, for example: -conn=127.0.0.1:12345")
-	flag.StringVar(&dashConnString, "dashconn", "http://127.0.0.1:3000/api/prediction/", "please enter http://<ip>:<port>/path of dashboard server, for example: -dashconn=http://127.0.0.1:3000/api/prediction/")
+	loader = config.NewLoader(flag.CommandLine, config.Default(), config.EvalServer, config.Dashboard, config.Key,
+		config.KeyFile, config.Padding, config.Cipher, config.DashSinks, config.DashTopic, config.DashFile,
+		config.DashOrigins, config.Broker, config.MQTTUser, config.MQTTPassword)
+	flag.IntVar(&dancers, "dancers", 3, "Enter number of dancers between 2 and 8, defaults to 3")
+	flag.StringVar(&policyString, "policy", "strict", "Enter policy: strict/ignore/repair, defaults to strict. Decides how position changes with a non zero sum are handled")
+	flag.DurationVar(&roundTimeout, "roundtimeout", 3*time.Second, "Max wait for every dancer's move after the first move of a round, the round is then decided with the moves received so far")
+	flag.StringVar(&strategyString, "vote", "majority", "Enter vote strategy: majority/weighted/highest, defaults to majority. weighted sums the confidence of each move, highest picks the single most confident move")
+	flag.StringVar(&tieBreakString, "tiebreak", "first", "Enter tie break: first/last/lead/random, defaults to first. Decides the move when several moves have the best score")
+	flag.IntVar(&dashQueue, "dashqueue", 256, "Max number of updates queued per dashboard sink while it is failing, the oldest is dropped once full")
+	flag.IntVar(&queueSize, "queue", 32, "Max number of messages queued for the eval server while disconnected, the oldest is dropped once full")
 	flag.StringVar(&mode, "mode", "single", "Enter mode: single/multi/standalone, defaults to single. Standalone mode runs multi, use it for testing without sending to EvalServer")
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
+func handleSignals(sigs <-chan os.Signal) {
+	sig := <-sigs
+	log.WithFields(log.Fields{
+		"signal": sig,
+	}).Info("Signal Received")
+	if evalClient != nil {
+		evalClient.Stop()
+	}
+	dash.Stop(dashFlush)
+	os.Exit(0)
+}
+
 func main() {
 	flag.Parse()
 
+	if err := position.ValidateDancers(dancers); err != nil {
+		log.Fatal(err)
+	}
+	calcPos = position.FormatPositions(position.InitialPositions(dancers))
+
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy, err = position.ParsePolicy(policyString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tieBreak, err = vote.ParseTieBreak(tieBreakString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	strategy, err = vote.ParseStrategy(strategyString)
+	if err != nil {
+		log.Fatal(err)
+	}
+	padding, err := codec.ParsePadding(cfg.Padding)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cipherMode, err := codec.ParseMode(cfg.Cipher)
+	if err != nil {
+		log.Fatal(err)
+	}
+	evalCodec, err = codec.NewCipher(cipherMode, []byte(cfg.Key), padding)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Key == config.Default().Key {
+		log.Warn("Using default AES key, pass -key, -keyfile or set LAPIS_KEY for anything but local testing")
+	}
+
 	log.Info("Starting in ", mode, " mode")
+	if queueSize < 1 {
+		log.Fatal("queue must be at least 1")
+	}
+	dataChannel = make(chan []byte, queueSize)
+	log.Info("Position policy | ", policy)
+	log.Info("Vote | ", strategy, " Tie break | ", tieBreak, " Round timeout | ", roundTimeout)
+	log.Info("Cipher | ", cipherMode, " Padding | ", padding)
+	if dashQueue < 1 {
+		log.Fatal("dashqueue must be at least 1")
+	}
+	if err := openDashboard(); err != nil {
+		log.Fatal(err)
+	}
 	if mode != "standalone" {
 		clientStart()
 	}
 
-	rand.Seed(time.Now().UnixNano())
+	// Signal stuff to flush queued dashboard updates on exit
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go handleSignals(signalChan)
+
 	startHTTPServer()
 
 	//sample := "#1 2 3|rocket|0.12"
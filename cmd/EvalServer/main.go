@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/QzSG/lapis-uno/cmd/internal/codec"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	"github.com/QzSG/lapis-uno/cmd/internal/position"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultMoves : Moves used when generating a script
+var defaultMoves = []string{"zigzag", "rocket", "hair", "pushback", "elbowlock", "windowwipe", "scarecrow", "shouldershrug"}
+
+var (
+	dancers    int
+	scriptFile string
+	rounds     int
+	seed       int64
+	replyPad   int
+
+	loader *config.Loader
+	cfg    *config.Config
+
+	evalCodec codec.Cipher
+)
+
+// round : Ground truth of a single round
+type round struct {
+	positions []int
+	move      string
+}
+
+// scorer : Scores received messages against the script, shared by all connections
+type scorer struct {
+	mu     sync.Mutex
+	script []round
+	next   int
+
+	posCorrect  int
+	moveCorrect int
+	delaySum    float64
+	delays      int // rounds with a valid delay, the average only covers these
+	scored      int
+}
+
+// score : Scores a decrypted #pos|move|delay message against the current round
+// Returns the correct positions of the round, false once the script is exhausted
+func (s *scorer) score(msg string) ([]int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.script) {
+		return nil, false
+	}
+	truth := s.script[s.next]
+	s.next++
+
+	fields := strings.Split(strings.TrimPrefix(strings.TrimSpace(msg), "#"), "|")
+	if len(fields) < 3 {
+		log.Warn("Round ", s.next, " | malformed message, expected #pos|move|delay | ", msg)
+		return truth.positions, true
+	}
+	s.scored++
+
+	posOK := false
+	if positions, err := position.ParsePositions(fields[0]); err == nil {
+		posOK = position.FormatPositions(positions) == position.FormatPositions(truth.positions)
+	}
+	moveOK := strings.TrimSpace(fields[1]) == truth.move
+	delay, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+	if err != nil {
+		log.Warn("Round ", s.next, " | invalid delay ", fields[2], ", left out of the average delay")
+	} else {
+		s.delaySum += delay
+		s.delays++
+	}
+	if posOK {
+		s.posCorrect++
+	}
+	if moveOK {
+		s.moveCorrect++
+	}
+
+	log.WithFields(log.Fields{
+		"Round":     s.next,
+		"Positions": fields[0],
+		"TruePos":   position.FormatPositions(truth.positions),
+		"Move":      fields[1],
+		"TrueMove":  truth.move,
+		"Delay":     delay,
+		"PosOK":     posOK,
+		"MoveOK":    moveOK,
+	}).Info("Scored")
+	return truth.positions, true
+}
+
+func (s *scorer) summary() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scored == 0 {
+		log.Info("No rounds scored")
+		return
+	}
+	fields := log.Fields{
+		"Rounds":    s.scored,
+		"Positions": fmt.Sprintf("%d/%d", s.posCorrect, s.scored),
+		"Moves":     fmt.Sprintf("%d/%d", s.moveCorrect, s.scored),
+		"AvgDelay":  "none valid",
+	}
+	if s.delays > 0 {
+		fields["AvgDelay"] = s.delaySum / float64(s.delays)
+	}
+	log.WithFields(fields).Info("Summary")
+}
+
+// loadScript : Reads one round per line formatted as <positions>|<move> ie: 2 1 3|rocket, blank lines and lines starting with # are skipped
+func loadScript(path string) ([]round, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var script []round
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "|")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected <positions>|<move>", path, lineNo)
+		}
+		positions, err := position.ParsePositions(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		tracker := position.NewPositionTracker(dancers, nil)
+		if err := tracker.Reset(positions); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		script = append(script, round{positions: positions, move: strings.TrimSpace(fields[1])})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(script) == 0 {
+		return nil, fmt.Errorf("%s: script has no rounds", path)
+	}
+	return script, nil
+}
+
+// generateScript : Returns n rounds of random positions and moves
+func generateScript(n int, r *rand.Rand) []round {
+	script := make([]round, n)
+	for i := range script {
+		positions := r.Perm(dancers)
+		for j := range positions {
+			positions[j]++
+		}
+		script[i] = round{positions: positions, move: defaultMoves[r.Intn(len(defaultMoves))]}
+	}
+	return script
+}
+
+// maxPending : Bytes buffered without finding a message before they are dropped as garbage
+const maxPending = 4096
+
+// nextMessage : Returns the plaintext of the first message in buf and the bytes it took up, 0 if buf holds no whole message yet
+// Messages carry no delimiter, so the message is the longest base64 prefix of buf which decrypts to printable text
+// A prefix running into the next message decrypts to garbage, or fails authentication with gcm. With cbc and space padding
+// a message split on a block boundary could still be taken early, EvalClient avoids this by writing each message at once
+func nextMessage(buf []byte) ([]byte, int) {
+	skip := 0
+	for skip < len(buf) && (buf[skip] == 0 || buf[skip] == ' ' || buf[skip] == '\r' || buf[skip] == '\n' || buf[skip] == '\t') {
+		skip++
+	}
+	msg := buf[skip:]
+	for end := len(msg) - len(msg)%4; end > 0; end -= 4 {
+		plaintext, err := evalCodec.Decrypt(string(msg[:end]))
+		if err == nil && printable(plaintext) {
+			return plaintext, skip + end
+		}
+	}
+	return nil, 0
+}
+
+func printable(data []byte) bool {
+	for _, b := range data {
+		if b < ' ' || b > '~' {
+			return false
+		}
+	}
+	return len(data) > 0
+}
+
+// handleConn : Replies to every message with the correct positions ie: "2 1 3", NUL padded to replyPad bytes if set
+// Reads are buffered, a message split over several reads or several messages in one read are framed by nextMessage
+func handleConn(conn net.Conn, s *scorer) {
+	defer conn.Close()
+	log.Info("EvalClient connected | ", conn.RemoteAddr())
+
+	buf := make([]byte, 1024)
+	var pending []byte
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if len(pending) > 0 {
+				log.Warn("Dropped ", len(pending), " bytes of an incomplete message")
+			}
+			log.Info("EvalClient disconnected | ", conn.RemoteAddr(), " | ", err)
+			return
+		}
+		pending = append(pending, buf[:n]...)
+
+		for {
+			plaintext, used := nextMessage(pending)
+			if used == 0 {
+				break
+			}
+			pending = pending[used:]
+			log.Debug("Received | ", string(plaintext))
+
+			positions, ok := s.score(string(plaintext))
+			if !ok {
+				log.Info("Script finished, closing connection")
+				s.summary()
+				return
+			}
+			reply := []byte(position.FormatPositions(positions))
+			if len(reply) < replyPad {
+				reply = append(reply, make([]byte, replyPad-len(reply))...)
+			}
+			if _, err := conn.Write(reply); err != nil {
+				log.Error("Failed to reply | ", err)
+				return
+			}
+		}
+		if len(pending) > maxPending {
+			log.Error("Failed to decrypt, dropped ", len(pending), " buffered bytes")
+			pending = nil
+		}
+	}
+}
+
+func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
+	sig := <-sigs
+	log.WithFields(log.Fields{
+		"signal": sig,
+	}).Info("Signal Received")
+	done <- struct{}{}
+}
+
+func init() {
+	flag.IntVar(&dancers, "dancers", 3, "Enter number of dancers between 2 and 8, defaults to 3")
+	flag.StringVar(&scriptFile, "script", "", "Optional, ground truth file with one <positions>|<move> round per line ie: 2 1 3|rocket, generated at random if not passed")
+	flag.IntVar(&rounds, "rounds", 20, "Number of rounds to generate when -script is not passed")
+	flag.Int64Var(&seed, "seed", 0, "Seed for the generated script, defaults to current time")
+	flag.IntVar(&replyPad, "replypad", 0, "Optional, NUL pad replies to this many bytes, defaults to 0 which sends them unpadded")
+	loader = config.NewLoader(flag.CommandLine, config.Default(), config.EvalServer, config.Key, config.KeyFile, config.Padding, config.Cipher)
+
+	log.SetOutput(os.Stdout)
+	log.SetLevel(log.DebugLevel)
+}
+
+func main() {
+	// Signal stuff to handle graceful exits
+	signalChan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go handleSignals(signalChan, done)
+
+	flag.Parse()
+	if err := position.ValidateDancers(dancers); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	padding, err := codec.ParsePadding(cfg.Padding)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cipherMode, err := codec.ParseMode(cfg.Cipher)
+	if err != nil {
+		log.Fatal(err)
+	}
+	evalCodec, err = codec.NewCipher(cipherMode, []byte(cfg.Key), padding)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var script []round
+	if scriptFile != "" {
+		script, err = loadScript(scriptFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		script = generateScript(rounds, rand.New(rand.NewSource(seed)))
+		log.Info("Generated ", rounds, " rounds with -seed=", seed)
+	}
+	s := &scorer{script: script}
+
+	listener, err := net.Listen("tcp", cfg.EvalServer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Info("Eval server simulator listening on ", listener.Addr(), " | cipher ", cipherMode, " padding ", padding, " | reply padding ", replyPad)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleConn(conn, s)
+		}
+	}()
+
+	// Signal stuff
+	<-done
+	listener.Close()
+	s.summary()
+}
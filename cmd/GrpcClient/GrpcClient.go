@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"io"
 	"os"
 	"os/signal"
@@ -15,6 +16,8 @@ import (
 	"google.golang.org/grpc/keepalive"
 )
 
+var batchSize int
+
 func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 	sig := <-sigs
 	log.WithFields(log.Fields{
@@ -24,12 +27,71 @@ func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 }
 
 func init() {
+	flag.IntVar(&batchSize, "batch", 1, "Readings per gRPC message, defaults to 1 which uses ReadingStream, above 1 uses ReadingBatchStream")
 	//log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
 
-func runReadingStream(client pb.SensorClient) {
+// readingSender : Sends readings over ReadingStream or ReadingBatchStream
+type readingSender interface {
+	send(reading *pb.Reading) error
+	flush() error
+	Recv() (*pb.Reply, error)
+	CloseSend() error
+}
+
+type singleSender struct {
+	pb.Sensor_ReadingStreamClient
+}
+
+func (s singleSender) send(reading *pb.Reading) error {
+	return s.Send(reading)
+}
+
+func (s singleSender) flush() error {
+	return nil
+}
+
+// batchSender : Sends readings in batches of batchSize, a start of move reading is sent right away with the readings before it
+type batchSender struct {
+	pb.Sensor_ReadingBatchStreamClient
+	batch *pb.ReadingBatch
+}
+
+func (s *batchSender) send(reading *pb.Reading) error {
+	s.batch.Readings = append(s.batch.Readings, reading)
+	if len(s.batch.Readings) >= batchSize || reading.IsStartMove {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *batchSender) flush() error {
+	if len(s.batch.Readings) == 0 {
+		return nil
+	}
+	err := s.Send(s.batch)
+	s.batch = &pb.ReadingBatch{}
+	return err
+}
+
+func newSender(client pb.SensorClient) (readingSender, error) {
+	if batchSize > 1 {
+		stream, err := client.ReadingBatchStream(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		return &batchSender{Sensor_ReadingBatchStreamClient: stream, batch: &pb.ReadingBatch{}}, nil
+	}
 	stream, err := client.ReadingStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return singleSender{stream}, nil
+}
+
+func runReadingStream(client pb.SensorClient) {
+	stream, err := newSender(client)
 	if err != nil {
 		log.Fatal(client, err)
 	}
@@ -45,7 +107,16 @@ func runReadingStream(client pb.SensorClient) {
 			if err != nil {
 				log.Fatalf("Failed to receive a reply status : %v", err)
 			}
-			log.Debug("Got reply status ", in.Status)
+			log.WithFields(log.Fields{
+				"StreamSeq":      in.StreamSeq,
+				"AckedStreamSeq": in.AckedStreamSeq,
+				"Connected":      in.BrokerConnected,
+				"Buffer":         in.BufferUsage,
+				"BackoffMs":      in.BackoffMs,
+			}).Debug("Got reply status ", in.Status)
+			if len(in.FailedStreamSeqs) > 0 {
+				log.Warn("Readings not published, stream seqs | ", in.FailedStreamSeqs)
+			}
 		}
 	}()
 
@@ -68,7 +139,7 @@ T:
 		case <-ticker.C:
 
 			reading = util.RandReading()
-			if err := stream.Send(reading); err != nil {
+			if err := stream.send(reading); err != nil {
 				log.Fatalf("Failed to send a reading: %v", err)
 			}
 			log.Debug(reading)
@@ -76,11 +147,15 @@ T:
 		}
 	}
 
+	if err := stream.flush(); err != nil {
+		log.Fatalf("Failed to send a reading: %v", err)
+	}
 	stream.CloseSend()
 	<-waitServerClose
 }
 
 func main() {
+	flag.Parse()
 
 	// Signal stuff to handle graceful exits
 	signalChan := make(chan os.Signal, 1)
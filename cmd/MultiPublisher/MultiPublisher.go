@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,6 +14,8 @@ import (
 	pb "github.com/QzSG/lapis-uno/protobuf"
 
 	ntp "github.com/QzSG/lapis-uno/cmd/NTP"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	"github.com/QzSG/lapis-uno/cmd/internal/position"
 	"github.com/QzSG/lapis-uno/cmd/internal/util"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
@@ -25,22 +28,30 @@ func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 		"signal": sig,
 	}).Info("Signal Received")
 
-	client1.Disconnect(100)
-	client2.Disconnect(100)
-	client3.Disconnect(100)
+	for _, client := range clients {
+		client.Disconnect(100)
+	}
 	done <- struct{}{}
 }
 
 func init() {
+	defaults := config.Default()
+	defaults.Broker.Username = "bench"
+	defaults.Broker.Password = "bench"
+	loader = config.NewLoader(flag.CommandLine, defaults, config.Broker, config.MQTTUser, config.MQTTPassword,
+		config.StartQoS, config.DataQoS, config.Retain, config.NTPServers, config.NTPResync)
+	flag.IntVar(&dancers, "dancers", 3, "Enter number of dancers between 2 and 8, defaults to 3")
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
 
 var (
-	clock   = time.Now()
-	client1 mqtt.Client
-	client2 mqtt.Client
-	client3 mqtt.Client
+	clock   = ntp.NewSyncedClock()
+	clients []mqtt.Client
+	dancers int
+
+	loader *config.Loader
+	cfg    *config.Config
 )
 
 func main() {
@@ -51,18 +62,29 @@ func main() {
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 	go handleSignals(signalChan, done)
 
+	flag.Parse()
+	if err := position.ValidateDancers(dancers); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Info("Starting NTPClient to get offset")
 
-	clockOffset, err := ntp.Offset()
-	if err != nil {
-		log.Error(err.Error())
+	ntpClient := &ntp.Client{Servers: cfg.NTP.Servers, Samples: cfg.NTP.Samples}
+	clockSync := ntpClient.StartResync(cfg.NTP.Resync, clock.Update)
+	defer clockSync.Stop()
+	if sample, ok, err := clockSync.Last(); ok {
+		log.Info("NTP Server:", sample.Server, " Delay:", sample.Delay)
+	} else {
+		log.Error("NTP sync failed, using system clock | ", err)
 	}
-	log.Info("NTP Offset:", clockOffset)
-	log.Info("NTP Clock:", clock.Add(time.Since(clock)+clockOffset))
-	const ClientID1 = "1"
-	const ClientID2 = "2"
-	const ClientID3 = "3"
-	const BrokerConfig = "ssl://mqtts.qz.sg:8883"
+	log.Info("NTP Offset:", clock.Offset(), " Uncertainty:", clock.Uncertainty())
+	log.Info("NTP Clock:", clock.Now())
+	var BrokerConfig = cfg.Broker.URL
 
 	log.Info("Connecting to " + BrokerConfig)
 
@@ -72,41 +94,35 @@ func main() {
 		ClientCAs:  nil,
 	}
 
-	opts := mqtt.NewClientOptions().AddBroker(BrokerConfig).SetClientID(ClientID1)
+	opts := mqtt.NewClientOptions().AddBroker(BrokerConfig)
 	opts.SetTLSConfig(tlsConfig)
-	opts.SetUsername("bench")
-	opts.SetPassword("bench")
+	opts.SetUsername(cfg.Broker.Username)
+	opts.SetPassword(cfg.Broker.Password)
 
 	/*log.WithFields(log.Fields{
 		"Topic": topic,
 	}).Info("Client set to publish to topic")
 	*/
-	client1 = mqtt.NewClient(opts)
-	if token := client1.Connect(); token.Wait() && token.Error() != nil {
-		log.Panic(token.Error())
-	} else {
-		log.Info("Client 1 Connected to MQTT Broker over TLS")
-	}
-
-	opts.SetClientID(ClientID2)
-	client2 = mqtt.NewClient(opts)
-	if token := client2.Connect(); token.Wait() && token.Error() != nil {
-		log.Panic(token.Error())
-	} else {
-		log.Info("Client 2 Connected to MQTT Broker over TLS")
-	}
-
-	opts.SetClientID(ClientID3)
-	client3 = mqtt.NewClient(opts)
-	if token := client3.Connect(); token.Wait() && token.Error() != nil {
-		log.Panic(token.Error())
-	} else {
-		log.Info("Client 3 Connected to MQTT Broker over TLS")
+	clientIDs := make([]string, dancers)
+	posChanges := make([]int32, dancers) // dancers 1 and 2 swap places, everyone else stays
+	for i := range clientIDs {
+		clientIDs[i] = fmt.Sprint(i + 1)
+
+		opts.SetClientID(clientIDs[i])
+		client := mqtt.NewClient(opts)
+		if token := client.Connect(); token.Wait() && token.Error() != nil {
+			log.Panic(token.Error())
+		} else {
+			log.Info("Client ", clientIDs[i], " Connected to MQTT Broker over TLS")
+		}
+		clients = append(clients, client)
 	}
+	posChanges[0] = 1
+	posChanges[1] = -1
 
 	var wg sync.WaitGroup
 	var periodms = 50
-	wg.Add(3000 / periodms)
+	wg.Add(dancers * 1000 / periodms)
 	time.Sleep(2 * time.Second)
 	ticker := time.NewTicker(time.Duration(time.Duration(periodms) * time.Millisecond))
 	defer ticker.Stop()
@@ -126,9 +142,9 @@ T:
 			break T
 		case <-ticker.C:
 			tickCount++
-			go publishReading(client1, clockOffset, ClientID1, &wg, start, 2)
-			go publishReading(client2, clockOffset, ClientID2, &wg, start, -1)
-			go publishReading(client3, clockOffset, ClientID3, &wg, start, -1)
+			for i, client := range clients {
+				go publishReading(client, clientIDs[i], &wg, start, posChanges[i])
+			}
 			if tickCount%3 == 0 {
 				start = !start
 			}
@@ -137,7 +153,7 @@ T:
 	<-done
 }
 
-func publishReading(client mqtt.Client, clockOffset time.Duration, clientID string, wg *sync.WaitGroup, start bool, posChange int32) {
+func publishReading(client mqtt.Client, clientID string, wg *sync.WaitGroup, start bool, posChange int32) {
 	defer wg.Done()
 
 	topic := fmt.Sprintf("sensor/%s/data", clientID)
@@ -148,7 +164,7 @@ func publishReading(client mqtt.Client, clockOffset time.Duration, clientID stri
 	reading.DancerNo = int32(dNo)
 	reading.PosChange = posChange + 3
 	reading.IsStartMove = start
-	reading.TimeStamp = clock.Add(time.Since(clock) + clockOffset).UnixNano()
+	reading.TimeStamp = clock.Now().UnixNano()
 	var flag int
 	if reading.IsStartMove {
 		flag = 1
@@ -160,7 +176,7 @@ func publishReading(client mqtt.Client, clockOffset time.Duration, clientID stri
 	if err != nil {
 		log.Fatalln("Failed to encode sensor reading:", err)
 	}
-	token := client.Publish(topic, 0, false, payload)
+	token := client.Publish(topic, cfg.Broker.QoS(reading.IsStartMove), cfg.Broker.Retain, payload)
 
 	token.Wait()
 
@@ -2,8 +2,10 @@ package ntp
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -98,66 +100,324 @@ type NTPPacket struct {
 	TransTimeFrac      uint32 // transmit time fraction
 }
 
-const liVNMode uint8 = 0b11100011    // unknown li, v4, client mode
-const server = "sg.pool.ntp.org:123" // using sg ntp pool as default server source alt: time.google.com
+const liVNMode uint8 = 0b11100011 // unknown li, v4, client mode
+
+const (
+	modeClient = 3
+	modeServer = 4
+
+	leapNotSync = 3 // leap indicator value for an unsynchronised clock
+
+	maxStratum = 15
+)
+
+// DefaultServers : Servers queried when none are configured, using sg ntp pool as default server source alt: time.google.com
+var DefaultServers = []string{"sg.pool.ntp.org:123", "time.google.com:123"}
 
 var nanoPerSec = uint64(time.Second.Nanoseconds())
 var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC) //ntp epoch starts at 1900
 
+// Errors returned for invalid server responses
+var (
+	ErrNotSynchronised = errors.New("ntp: server clock not synchronised")
+	ErrBadMode         = errors.New("ntp: response is not from a server")
+	ErrBadStratum      = errors.New("ntp: invalid stratum")
+	ErrBadOrigin       = errors.New("ntp: response origin timestamp does not match request")
+	ErrBadTime         = errors.New("ntp: invalid server timestamps")
+	ErrNoServers       = errors.New("ntp: no servers configured")
+)
+
+// KissOfDeathError : Server replied with a kiss-o'-death packet (stratum 0), Code is the ascii kiss code ie: RATE, DENY
+type KissOfDeathError struct {
+	Server string
+	Code   string
+}
+
+func (e *KissOfDeathError) Error() string {
+	return fmt.Sprintf("ntp: kiss-o'-death %s from %s", e.Code, e.Server)
+}
+
+// Sample : A single offset measurement
+type Sample struct {
+	Server  string
+	Offset  time.Duration // reference clock - system clock
+	Delay   time.Duration // round trip delay excluding server processing time
+	Stratum uint8
+}
+
+// Client : NTP client, samples every server several times and keeps the sample with the lowest round trip delay
+// Servers are sampled concurrently and Measure gives up after MaxWait, so an offline machine does not stall startup
+type Client struct {
+	Servers []string      // host:port of servers, DefaultServers if empty
+	Samples int           // samples per server, defaults to 4
+	Timeout time.Duration // per sample read deadline, defaults to 2s
+	MaxWait time.Duration // overall limit of Measure including name resolution, defaults to 3s
+}
+
 // Offset : Returns clock offset of system clock vs reference clock using NTP. Offset is returned as time.Duration
 func Offset() (time.Duration, error) {
-	var transmitTime time.Time
-
-	req := NTPPacket{
-		LiVnMode: liVNMode,
-	}
-	addr, err := net.ResolveUDPAddr("udp", server)
+	c := &Client{}
+	sample, err := c.Measure()
 	if err != nil {
 		return time.Duration(0), err
 	}
-	conn, _ := net.DialUDP("udp", nil, addr)
+	return sample.Offset, nil
+}
+
+// Measure : Samples all servers concurrently and returns the sample with the lowest round trip delay
+// Returns within MaxWait with the best sample so far, errors from individual servers are only returned if no server produced a valid sample
+func (c *Client) Measure() (Sample, error) {
+	servers := c.Servers
+	if len(servers) == 0 {
+		servers = DefaultServers
+	}
+	samples := c.Samples
+	if samples <= 0 {
+		samples = 4
+	}
+	maxWait := c.MaxWait
+	if maxWait <= 0 {
+		maxWait = 3 * time.Second
+	}
+	deadline := time.Now().Add(maxWait)
+
+	type result struct {
+		sample Sample
+		err    error
+	}
+	results := make(chan result, len(servers)*samples)
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server string) {
+			defer wg.Done()
+			for i := 0; i < samples && time.Now().Before(deadline); i++ {
+				sample, err := c.query(server, deadline)
+				results <- result{sample, err}
+				var kod *KissOfDeathError
+				if errors.As(err, &kod) {
+					return // server asked us to back off, do not resend
+				}
+			}
+		}(server)
+	}
+	wg.Wait()
+	close(results)
+
+	var best Sample
+	found := false
+	var lastErr error = ErrNoServers
+	for res := range results {
+		if res.err != nil {
+			lastErr = res.err
+			continue
+		}
+		if !found || res.sample.Delay < best.Delay {
+			best = res.sample
+			found = true
+		}
+	}
+	if !found {
+		return Sample{}, lastErr
+	}
+	return best, nil
+}
+
+// Query : Sends a single request to server and returns the validated sample
+func (c *Client) Query(server string) (Sample, error) {
+	return c.query(server, time.Time{})
+}
+
+// query : Same as Query, giving up at deadline if it is earlier than Timeout
+func (c *Client) query(server string, deadline time.Time) (Sample, error) {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	if d := time.Now().Add(timeout); deadline.IsZero() || d.Before(deadline) {
+		deadline = d
+	}
+
+	// Dialer deadline also bounds name resolution, which can hang while offline
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.Dial("udp", server)
 	if err != nil {
-		return time.Duration(0), err
+		return Sample{}, err
 	}
 	defer conn.Close()
+	conn.SetDeadline(deadline)
 
-	//fmt.Println(addr)
-	transmitTime = time.Now()
-	//fmt.Println(transmitTime.String())
+	transmitTime := time.Now()
+	transmit := ntpTime(transmitTime)
+	req := NTPPacket{
+		LiVnMode:      liVNMode,
+		TransTimeSec:  uint32(transmit >> 32),
+		TransTimeFrac: uint32(transmit & 0xffffffff),
+	}
 	if err := binary.Write(conn, binary.BigEndian, req); err != nil {
-		log.Fatalf("Failed to send NTP request: %v", err)
+		return Sample{}, fmt.Errorf("ntp: failed to send request to %s: %v", server, err)
 	}
 
 	response := &NTPPacket{}
-	if err := binary.Read(conn, binary.BigEndian, response); err != nil {
-		log.Fatalf("Failed to read server response: %v", err)
+	var recvTime time.Time
+	for {
+		if err := binary.Read(conn, binary.BigEndian, response); err != nil {
+			return Sample{}, fmt.Errorf("ntp: failed to read response from %s: %v", server, err)
+		}
+		// Monotonic reading keeps round trip measurement immune to wall clock jumps
+		recvTime = transmitTime.Add(time.Since(transmitTime))
+
+		err := validate(server, req, response)
+		if err == ErrBadOrigin {
+			log.Debug("NTP ignoring packet not answering our request from ", server)
+			continue // wait for the real reply until the deadline
+		}
+		if err != nil {
+			return Sample{}, err
+		}
+		break
 	}
 
-	delta := time.Since(transmitTime)
-	recvTime := ntpEpoch.Add(durationFromNTP(uint32(ntpTime(transmitTime.Add(delta))>>32), uint32(ntpTime(transmitTime.Add(delta))&0xffffffff)))
+	originTime := ntpEpoch.Add(durationFromNTP(req.TransTimeSec, req.TransTimeFrac))
 	destRecvTime := ntpEpoch.Add(durationFromNTP(response.RecvTimeSecond, response.RecvTimeFraction))
 	destTransTime := ntpEpoch.Add(durationFromNTP(response.TransTimeSec, response.TransTimeFrac))
-	originTime := ntpEpoch.Add(durationFromNTP(uint32(ntpTime(transmitTime)>>32), uint32(ntpTime(transmitTime)&0xffffffff)))
-
-	//fmt.Println(originTime.String(), destRecvTime.String(), destTransTime.String(), recvTime.String())
+	clientRecvTime := ntpEpoch.Add(durationFromNTP(uint32(ntpTime(recvTime)>>32), uint32(ntpTime(recvTime)&0xffffffff)))
 
 	forwardPath := destRecvTime.Sub(originTime)
-	backPath := destTransTime.Sub(recvTime)
-	offset := (forwardPath + backPath) / time.Duration(2)
+	backPath := destTransTime.Sub(clientRecvTime)
+	delay := clientRecvTime.Sub(originTime) - destTransTime.Sub(destRecvTime)
+	if delay < 0 {
+		delay = 0
+	}
+
+	return Sample{
+		Server:  server,
+		Offset:  (forwardPath + backPath) / time.Duration(2),
+		Delay:   delay,
+		Stratum: response.Stratum,
+	}, nil
+}
+
+// validate : Checks response answers req before trusting anything else in it
+// The origin timestamp is checked first so an off-path spoofed packet, kiss-o'-death included, cannot stop sampling
+func validate(server string, req NTPPacket, response *NTPPacket) error {
+	if response.OriginTimeSecond != req.TransTimeSec || response.OriginTimeFraction != req.TransTimeFrac {
+		return ErrBadOrigin
+	}
+	if response.LiVnMode&0b111 != modeServer {
+		return ErrBadMode
+	}
+	if response.Stratum == 0 {
+		code := make([]byte, 4)
+		binary.BigEndian.PutUint32(code, response.ReferenceID)
+		return &KissOfDeathError{Server: server, Code: string(code)}
+	}
+	if response.Stratum > maxStratum {
+		return ErrBadStratum
+	}
+	if response.LiVnMode>>6 == leapNotSync {
+		return ErrNotSynchronised
+	}
+	if response.TransTimeSec == 0 && response.TransTimeFrac == 0 {
+		return ErrBadTime
+	}
+	return nil
+}
+
+// Resync : Periodically measures offset in the background
+type Resync struct {
+	client   *Client
+	interval time.Duration
+	onUpdate func(Sample)
+
+	mu     sync.Mutex
+	last   Sample
+	err    error
+	synced bool
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// StartResync : Measures offset immediately then every interval until Stop is called
+// onUpdate, if not nil, is called with every successful sample. An interval <= 0 measures once only
+func (c *Client) StartResync(interval time.Duration, onUpdate func(Sample)) *Resync {
+	r := &Resync{
+		client:   c,
+		interval: interval,
+		onUpdate: onUpdate,
+		done:     make(chan struct{}),
+	}
+	r.measure()
+	if interval > 0 {
+		go r.run()
+	}
+	return r
+}
+
+// Offset : Returns latest measured offset, 0 if no measurement succeeded yet
+func (r *Resync) Offset() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last.Offset
+}
+
+// Last : Returns latest successful sample, false if none succeeded yet, and error of the latest attempt
+func (r *Resync) Last() (Sample, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last, r.synced, r.err
+}
+
+// Stop : Stops background measurements, safe to call more than once
+func (r *Resync) Stop() {
+	r.stopOnce.Do(func() { close(r.done) })
+}
+
+func (r *Resync) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.measure()
+		case <-r.done:
+			return
+		}
+	}
+}
 
-	//fmt.Println(forwardPath, backPath, offset)
-	return offset, nil
+func (r *Resync) measure() {
+	sample, err := r.client.Measure()
+	r.mu.Lock()
+	r.err = err
+	if err == nil {
+		r.last = sample
+		r.synced = true
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		log.Warn("NTP resync failed, keeping previous offset | ", err)
+		return
+	}
+	log.Debug("NTP resync | server ", sample.Server, " offset ", sample.Offset, " delay ", sample.Delay)
+	if r.onUpdate != nil {
+		r.onUpdate(sample)
+	}
 }
 
 func main() {
-	clockOffset, err := Offset()
+	clock := NewSyncedClock()
+	sample, err := (&Client{}).Measure()
 	if err != nil {
 		log.Error(err.Error())
+	} else {
+		clock.Update(sample)
 	}
 
-	clock := time.Now()
-	fmt.Printf("Clock offset : %s \n", clockOffset)
-	fmt.Println(time.Now().Add(clockOffset))
+	fmt.Printf("Clock offset : %s \n", clock.Offset())
+	fmt.Println(clock.Now())
 
 	ticker := time.NewTicker(time.Second)
 	done := make(chan bool)
@@ -168,7 +428,7 @@ func main() {
 			case <-done:
 				return
 			case <-ticker.C:
-				fmt.Println(clock.Add(time.Since(clock) + clockOffset))
+				fmt.Println(clock.Now(), "±", clock.Uncertainty())
 			}
 		}
 	}()
@@ -0,0 +1,172 @@
+package ntp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStratum = 1          // reference clock for the group when not relaying an upstream server
+	localRefID     = 0x4c4f434c // "LOCL", local clock reference id
+	serverPoll     = 4          // log2 seconds, 16s suggested poll interval
+	serverPrec     = -20        // log2 seconds, roughly 1 microsecond
+	packetSize     = 48         // size of NTPPacket, extension fields in requests are ignored
+	versionMask    = 0b00111000
+	modeMask       = 0b00000111
+)
+
+// Server : SNTP server, serves system clock plus Offset so one machine can act as the group's reference clock
+// Clients on an isolated network point -ntp at this server instead of a public pool
+type Server struct {
+	// Offset, if not nil, is added to the system clock before replying, ie: Resync.Offset to relay an upstream server
+	Offset func() time.Duration
+	// Stratum reported to clients while serving the local clock, defaults to 1
+	Stratum uint8
+	// Upstream, if not nil, returns the stratum of the relayed server and whether it has answered yet
+	// Replies report upstream stratum + 1 once it has. Until then the local clock is served at the highest valid stratum,
+	// so clients on an offline network still agree on a common time but can tell it is not synchronised to anything
+	Upstream func() (uint8, bool)
+
+	mu     sync.Mutex
+	conn   *net.UDPConn
+	closed bool
+}
+
+// ErrServerClosed : Returned by Serve and ListenAndServe after Close
+var ErrServerClosed = errors.New("ntp: server closed")
+
+// ListenAndServe : Listens on the UDP address addr and answers requests until Close is called
+func (s *Server) ListenAndServe(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn)
+}
+
+// Serve : Answers requests on conn until Close is called, conn is closed on return
+func (s *Server) Serve(conn *net.UDPConn) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return ErrServerClosed
+	}
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+
+	log.Info("SNTP server listening on ", conn.LocalAddr())
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		// Receive timestamp is taken as early as possible
+		recvTime := s.now()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				log.Warn("SNTP read error | ", err)
+				time.Sleep(time.Second)
+				continue
+			}
+			return err
+		}
+		if n < packetSize {
+			continue
+		}
+
+		resp, ok := s.respond(buf[:packetSize], recvTime)
+		if !ok {
+			continue
+		}
+		if _, err := conn.WriteToUDP(resp, addr); err != nil {
+			log.Warn("SNTP failed to reply to ", addr, " | ", err)
+		}
+	}
+}
+
+// Close : Stops the server
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Server) now() time.Time {
+	now := time.Now()
+	if s.Offset != nil {
+		now = now.Add(s.Offset())
+	}
+	return now
+}
+
+// respond : Builds the reply to a single request, false if the request should be ignored
+func (s *Server) respond(data []byte, recvTime time.Time) ([]byte, bool) {
+	req := NTPPacket{}
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &req); err != nil {
+		return nil, false
+	}
+	// Only answer client requests, replying to server or broadcast packets could loop between servers
+	if req.LiVnMode&modeMask != modeClient {
+		return nil, false
+	}
+
+	stratum := s.Stratum
+	if stratum == 0 {
+		stratum = defaultStratum
+	}
+	if s.Upstream != nil {
+		if upstream, ok := s.Upstream(); !ok || upstream >= maxStratum {
+			stratum = maxStratum
+		} else {
+			stratum = upstream + 1
+		}
+	}
+
+	recv := ntpTime(recvTime)
+	resp := NTPPacket{
+		LiVnMode:           req.LiVnMode&versionMask | modeServer, // echo client version
+		Stratum:            stratum,
+		Poll:               serverPoll,
+		Precision:          serverPrec,
+		ReferenceID:        localRefID,
+		RefTimeSecond:      uint32(recv >> 32),
+		RefTimeFraction:    uint32(recv & 0xffffffff),
+		OriginTimeSecond:   req.TransTimeSec,
+		OriginTimeFraction: req.TransTimeFrac,
+		RecvTimeSecond:     uint32(recv >> 32),
+		RecvTimeFraction:   uint32(recv & 0xffffffff),
+	}
+	transmit := ntpTime(s.now())
+	resp.TransTimeSec = uint32(transmit >> 32)
+	resp.TransTimeFrac = uint32(transmit & 0xffffffff)
+
+	out := &bytes.Buffer{}
+	if err := binary.Write(out, binary.BigEndian, resp); err != nil {
+		return nil, false
+	}
+	return out.Bytes(), true
+}
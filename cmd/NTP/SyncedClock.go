@@ -0,0 +1,103 @@
+package ntp
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// slewRate : Max rate the applied offset moves towards a new measurement, 500ppm ie: 0.5ms per second, same as ntpd
+	// Being far below 1 keeps Now monotonic while slewing backwards
+	slewRate = 500e-6
+	// driftRate : Assumed worst case drift of the system clock between syncs, 50ppm
+	driftRate = 50e-6
+)
+
+// SyncedClock : Reference clock built from the monotonic system clock plus an NTP offset
+// The first sample steps the offset, later samples are slewed in gradually so timestamps never jump or go backwards
+type SyncedClock struct {
+	mu   sync.Mutex
+	base time.Time // monotonic anchor, all elapsed times are measured from here
+
+	synced   bool
+	applied  time.Duration // offset applied at updated
+	target   time.Duration // latest measured offset
+	updated  time.Duration // elapsed since base at last Update
+	lastSync time.Duration // elapsed since base at last successful sample
+	delay    time.Duration // round trip delay of last sample
+}
+
+// NewSyncedClock : Returns a clock with zero offset, feed it samples with Update ie: Client.StartResync(interval, clock.Update)
+func NewSyncedClock() *SyncedClock {
+	return &SyncedClock{base: time.Now()}
+}
+
+// Update : Applies a new offset measurement
+func (c *SyncedClock) Update(sample Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elapsed := time.Since(c.base)
+	if !c.synced {
+		c.applied = sample.Offset
+		c.synced = true
+	} else {
+		c.applied = c.offsetAt(elapsed)
+	}
+	c.target = sample.Offset
+	c.updated = elapsed
+	c.lastSync = elapsed
+	c.delay = sample.Delay
+}
+
+// Now : Returns current reference time
+func (c *SyncedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elapsed := time.Since(c.base)
+	return c.base.Add(elapsed + c.offsetAt(elapsed))
+}
+
+// Offset : Returns offset currently applied to the system clock
+func (c *SyncedClock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offsetAt(time.Since(c.base))
+}
+
+// Synced : Returns true once at least one sample has been applied
+func (c *SyncedClock) Synced() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.synced
+}
+
+// Uncertainty : Returns estimated max error of Now, 0 if never synced as there is nothing to estimate against
+// Made up of half the round trip delay of the last sample, offset still left to slew and assumed drift since the last sample
+func (c *SyncedClock) Uncertainty() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.synced {
+		return 0
+	}
+	elapsed := time.Since(c.base)
+	remaining := c.target - c.offsetAt(elapsed)
+	if remaining < 0 {
+		remaining = -remaining
+	}
+	drift := time.Duration(float64(elapsed-c.lastSync) * driftRate)
+	return c.delay/2 + remaining + drift
+}
+
+// offsetAt : Returns offset applied at elapsed, caller must hold c.mu
+func (c *SyncedClock) offsetAt(elapsed time.Duration) time.Duration {
+	maxStep := time.Duration(float64(elapsed-c.updated) * slewRate)
+	diff := c.target - c.applied
+	switch {
+	case diff > maxStep:
+		return c.applied + maxStep
+	case diff < -maxStep:
+		return c.applied - maxStep
+	default:
+		return c.target
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	ntp "github.com/QzSG/lapis-uno/cmd/NTP"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	listen   string
+	stratum  uint
+	upstream bool
+
+	loader *config.Loader
+	cfg    *config.Config
+)
+
+func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
+	sig := <-sigs
+	log.WithFields(log.Fields{
+		"signal": sig,
+	}).Info("Signal Received")
+	done <- struct{}{}
+}
+
+func init() {
+	flag.StringVar(&listen, "listen", ":123", "UDP address to serve SNTP on, ports below 1024 may need root, for example: -listen=:1123")
+	flag.UintVar(&stratum, "stratum", 1, "Stratum reported to clients while serving the local clock without -upstream, 1 to 15")
+	flag.BoolVar(&upstream, "upstream", false, "Relay time of the configured NTP servers (-ntp) instead of serving the local clock as is, the local clock is served at stratum 15 until they first answer")
+	loader = config.NewLoader(flag.CommandLine, config.Default(), config.NTPServers, config.NTPResync)
+
+	log.SetOutput(os.Stdout)
+	log.SetLevel(log.DebugLevel)
+}
+
+func main() {
+	// Signal stuff to handle graceful exits
+	signalChan := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go handleSignals(signalChan, done)
+
+	flag.Parse()
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if stratum < 1 || stratum > 15 {
+		log.Fatal("stratum must be between 1 and 15")
+	}
+
+	srv := &ntp.Server{Stratum: uint8(stratum)}
+	if upstream {
+		ntpClient := &ntp.Client{Servers: cfg.NTP.Servers, Samples: cfg.NTP.Samples}
+		// The first upstream sample steps the offset, so clients served the local clock until then see time jump once
+		// Later samples are slewed in gradually
+		clock := ntp.NewSyncedClock()
+		clockSync := ntpClient.StartResync(cfg.NTP.Resync, clock.Update)
+		defer clockSync.Stop()
+
+		// Offset stays 0 until upstream first answers, after that the last measured offset is kept while it is unreachable
+		srv.Offset = clock.Offset
+		srv.Upstream = func() (uint8, bool) {
+			sample, ok, _ := clockSync.Last()
+			return sample.Stratum, ok
+		}
+		if sample, ok, _ := clockSync.Last(); ok {
+			log.Info("Relaying ", sample.Server, " | offset ", sample.Offset)
+		} else {
+			log.Warn("Upstream NTP servers unreachable, serving local clock at stratum 15 until they answer, time steps once they do")
+		}
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(listen); err != nil && err != ntp.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Signal stuff
+	<-done
+	srv.Close()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -11,6 +12,7 @@ import (
 	pb "github.com/QzSG/lapis-uno/protobuf"
 
 	ntp "github.com/QzSG/lapis-uno/cmd/NTP"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
 	"github.com/QzSG/lapis-uno/cmd/internal/util"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
@@ -26,12 +28,20 @@ func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
 }
 
 func init() {
+	defaults := config.Default()
+	defaults.Broker.Username = "bench"
+	defaults.Broker.Password = "bench"
+	loader = config.NewLoader(flag.CommandLine, defaults, config.Broker, config.MQTTUser, config.MQTTPassword,
+		config.StartQoS, config.DataQoS, config.Retain, config.NTPServers, config.NTPResync)
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
 
 var (
-	clock = time.Now()
+	clock = ntp.NewSyncedClock()
+
+	loader *config.Loader
+	cfg    *config.Config
 )
 
 func main() {
@@ -42,18 +52,30 @@ func main() {
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 	go handleSignals(signalChan, done)
 
+	flag.Parse()
+	var err error
+	cfg, err = loader.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Info("Starting NTPClient to get offset")
 
-	clockOffset, err := ntp.Offset()
-	if err != nil {
-		log.Error(err.Error())
+	ntpClient := &ntp.Client{Servers: cfg.NTP.Servers, Samples: cfg.NTP.Samples}
+	clockSync := ntpClient.StartResync(cfg.NTP.Resync, clock.Update)
+	defer clockSync.Stop()
+	if sample, ok, err := clockSync.Last(); ok {
+		log.Info("NTP Server:", sample.Server, " Delay:", sample.Delay)
+	} else {
+		log.Error("NTP sync failed, using system clock | ", err)
 	}
-	log.Info("Clock Offset:", clockOffset)
+	log.Info("NTP Offset:", clock.Offset(), " Uncertainty:", clock.Uncertainty())
+	log.Info("NTP Clock:", clock.Now())
 
 	const ClientID1 = "lapis-client-test-111"
 	const ClientID2 = "lapis-client-test-222"
 	const ClientID3 = "lapis-client-test-333"
-	const BrokerConfig = "ssl://mqtts.qz.sg:8883"
+	var BrokerConfig = cfg.Broker.URL
 
 	log.Info("Connecting to " + BrokerConfig)
 
@@ -65,8 +87,8 @@ func main() {
 
 	opts := mqtt.NewClientOptions().AddBroker(BrokerConfig).SetClientID(ClientID1)
 	opts.SetTLSConfig(tlsConfig)
-	opts.SetUsername("bench")
-	opts.SetPassword("bench")
+	opts.SetUsername(cfg.Broker.Username)
+	opts.SetPassword(cfg.Broker.Password)
 
 	/*log.WithFields(log.Fields{
 		"Topic": topic,
@@ -98,80 +120,80 @@ func main() {
 T:
 	for {
 
-		start := publishReading(client1, clockOffset, ClientID1, true)
+		start := publishReading(client1, ClientID1, true)
 		log.Debug("C1 sent at ", start.UnixNano())
 
 		time.Sleep(10 * time.Millisecond)
-		publishReading(client1, clockOffset, ClientID1, true)
+		publishReading(client1, ClientID1, true)
 		time.Sleep(10 * time.Millisecond)
-		publishReading(client1, clockOffset, ClientID1, true)
+		publishReading(client1, ClientID1, true)
 		time.Sleep(10 * time.Millisecond)
 
 		_, err = fmt.Scan(&last)
 
 		if last == 2 {
-			log.Infoln("Elapsed |", time.Since(start)+clockOffset, "Sending packet for client 3")
-			mid := publishReading(client3, clockOffset, ClientID3, true)
+			log.Infoln("Elapsed |", clock.Now().Sub(start), "Sending packet for client 3")
+			mid := publishReading(client3, ClientID3, true)
 			log.Debug("C3 sent at ", mid.UnixNano())
 
-			publishReading(client1, clockOffset, ClientID1, true)
+			publishReading(client1, ClientID1, true)
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client1, clockOffset, ClientID1, true)
-			publishReading(client3, clockOffset, ClientID3, true)
+			publishReading(client1, ClientID1, true)
+			publishReading(client3, ClientID3, true)
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client3, clockOffset, ClientID3, true)
+			publishReading(client3, ClientID3, true)
 
 			log.Infoln("Elapsed |", mid.Sub(start), "Sending packet for client 2")
-			end := publishReading(client2, clockOffset, ClientID2, true)
+			end := publishReading(client2, ClientID2, true)
 			log.Debug("C2 sent at ", end.UnixNano())
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client2, clockOffset, ClientID2, true)
+			publishReading(client2, ClientID2, true)
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client2, clockOffset, ClientID2, true)
+			publishReading(client2, ClientID2, true)
 
 			log.Infoln("Elapsed |", end.Sub(start), "Sync Delay between Client 1 and 2")
 
 			//Send idle packets
-			publishReading(client1, clockOffset, ClientID1, false)
-			publishReading(client2, clockOffset, ClientID2, false)
-			publishReading(client3, clockOffset, ClientID3, false)
+			publishReading(client1, ClientID1, false)
+			publishReading(client2, ClientID2, false)
+			publishReading(client3, ClientID3, false)
 			time.Sleep(5 * time.Millisecond)
-			publishReading(client1, clockOffset, ClientID1, false)
-			publishReading(client2, clockOffset, ClientID2, false)
-			publishReading(client3, clockOffset, ClientID3, false)
+			publishReading(client1, ClientID1, false)
+			publishReading(client2, ClientID2, false)
+			publishReading(client3, ClientID3, false)
 			//time.Sleep(50 * time.Millisecond)
 		}
 		if last == 3 {
-			log.Infoln("Elapsed |", time.Since(start)+clockOffset, "Sending packet for client 2")
-			mid := publishReading(client2, clockOffset, ClientID2, true)
+			log.Infoln("Elapsed |", clock.Now().Sub(start), "Sending packet for client 2")
+			mid := publishReading(client2, ClientID2, true)
 			log.Debug("C2 sent at ", mid.UnixNano())
 
-			publishReading(client1, clockOffset, ClientID1, true)
+			publishReading(client1, ClientID1, true)
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client1, clockOffset, ClientID1, true)
-			publishReading(client2, clockOffset, ClientID2, true)
+			publishReading(client1, ClientID1, true)
+			publishReading(client2, ClientID2, true)
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client2, clockOffset, ClientID2, true)
+			publishReading(client2, ClientID2, true)
 
 			log.Infoln("Elapsed |", mid.Sub(start), "Sending packet for client 3")
-			end := publishReading(client3, clockOffset, ClientID3, true)
+			end := publishReading(client3, ClientID3, true)
 			log.Debug("C3 sent at ", end.UnixNano())
 
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client3, clockOffset, ClientID3, true)
+			publishReading(client3, ClientID3, true)
 			time.Sleep(10 * time.Millisecond)
-			publishReading(client3, clockOffset, ClientID3, true)
+			publishReading(client3, ClientID3, true)
 
 			log.Infoln("Elapsed |", end.Sub(start), "Sync Delay between Client 1 and 3")
 
 			//Send idle packets
-			publishReading(client1, clockOffset, ClientID1, false)
-			publishReading(client2, clockOffset, ClientID2, false)
-			publishReading(client3, clockOffset, ClientID3, false)
+			publishReading(client1, ClientID1, false)
+			publishReading(client2, ClientID2, false)
+			publishReading(client3, ClientID3, false)
 			time.Sleep(5 * time.Millisecond)
-			publishReading(client1, clockOffset, ClientID1, false)
-			publishReading(client2, clockOffset, ClientID2, false)
-			publishReading(client3, clockOffset, ClientID3, false)
+			publishReading(client1, ClientID1, false)
+			publishReading(client2, ClientID2, false)
+			publishReading(client3, ClientID3, false)
 			//time.Sleep(50 * time.Millisecond)
 		}
 		if last == 4 {
@@ -184,7 +206,7 @@ T:
 	client3.Disconnect(10)
 }
 
-func publishReading(client mqtt.Client, clockOffset time.Duration, clientID string, isStart bool) time.Time {
+func publishReading(client mqtt.Client, clientID string, isStart bool) time.Time {
 
 	topic := fmt.Sprintf("sensor/%s/data", clientID)
 	var reading *pb.Reading
@@ -196,13 +218,13 @@ func publishReading(client mqtt.Client, clockOffset time.Duration, clientID stri
 		reading.IsStartMove = false
 	}
 	reading.ClientID = clientID
-	readingTime := clock.Add(time.Since(clock) + clockOffset)
+	readingTime := clock.Now()
 	reading.TimeStamp = readingTime.UnixNano()
 	payload, err := proto.Marshal(reading)
 	if err != nil {
 		log.Fatalln("Failed to encode sensor reading:", err)
 	}
-	token := client.Publish(topic, 0, false, payload)
+	token := client.Publish(topic, cfg.Broker.QoS(reading.IsStartMove), cfg.Broker.Retain, payload)
 	token.Wait()
 	//fmt.Println("Reading:", reading)
 	return readingTime
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
@@ -11,6 +12,8 @@ import (
 	"time"
 
 	ntp "github.com/QzSG/lapis-uno/cmd/NTP"
+	"github.com/QzSG/lapis-uno/cmd/internal/config"
+	"github.com/QzSG/lapis-uno/cmd/internal/position"
 	pb "github.com/QzSG/lapis-uno/protobuf"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/golang/protobuf/proto"
@@ -18,10 +21,13 @@ import (
 )
 
 var (
-	clock    = time.Now()
-	offset   time.Duration
+	clock    = ntp.NewSyncedClock()
 	start    = make(chan startPacket)
 	calcDone = make(chan struct{})
+	dancers  int
+
+	loader *config.Loader
+	cfg    *config.Config
 )
 
 func handleSignals(sigs <-chan os.Signal, done chan<- struct{}) {
@@ -46,10 +52,16 @@ var f mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
 		log.Info(time.Unix(0, reading.GetTimeStamp()).UnixNano(), " ", clientID)
 		start <- startPacket{clientID: clientID, timeStamp: reading.GetTimeStamp()}
 	}
-	fmt.Printf("Elapsed[ms]: %s\n", clock.Add(time.Since(clock)+offset).Sub(time.Unix(0, reading.GetTimeStamp())))
+	fmt.Printf("Elapsed[ms]: %s\n", clock.Now().Sub(time.Unix(0, reading.GetTimeStamp())))
 }
 
 func init() {
+	defaults := config.Default()
+	defaults.Broker.Username = "bench"
+	defaults.Broker.Password = "bench"
+	loader = config.NewLoader(flag.CommandLine, defaults, config.Broker, config.MQTTUser, config.MQTTPassword,
+		config.StartQoS, config.DataQoS, config.NTPServers, config.NTPResync)
+	flag.IntVar(&dancers, "dancers", 3, "Enter number of dancers between 2 and 8, defaults to 3")
 	//log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 }
@@ -60,28 +72,20 @@ type startPacket struct {
 }
 
 func calcLatency() {
-	var Client1, Client2, Client3 startPacket
+	var packets []startPacket
 	var syncDelay time.Duration
-	received := 0
 	for {
 		select {
 		case pack := <-start:
-			received++
+			packets = append(packets, pack)
 			log.Info("Received start packet from", pack.clientID)
-			if received == 1 {
-				Client1 = pack
-			}
-			if received == 2 {
-				Client2 = pack
-			}
-			if received == 3 {
-				Client3 = pack
-				packets := []startPacket{Client1, Client2, Client3}
+			if len(packets) == dancers {
 				sort.Slice(packets, func(i, j int) bool { return packets[i].timeStamp < packets[j].timeStamp })
+				fastest, slowest := packets[0], packets[len(packets)-1]
 				log.Info("Calculating syncDelay...")
-				syncDelay = time.Unix(0, packets[2].timeStamp).Sub(time.Unix(0, packets[0].timeStamp))
-				fmt.Println("syncDelay between ", packets[0].clientID, " and ", packets[2].clientID, " is :", syncDelay)
-				received = 0
+				syncDelay = time.Unix(0, slowest.timeStamp).Sub(time.Unix(0, fastest.timeStamp))
+				fmt.Println("syncDelay between ", fastest.clientID, " and ", slowest.clientID, " is :", syncDelay)
+				packets = nil
 			}
 		case <-calcDone:
 			return
@@ -98,18 +102,31 @@ func main() {
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 	go handleSignals(signalChan, done)
 
-	log.Info("Starting NTPClient to get offset")
-
-	clockOffset, err := ntp.Offset()
+	flag.Parse()
+	if err := position.ValidateDancers(dancers); err != nil {
+		log.Fatal(err)
+	}
+	var err error
+	cfg, err = loader.Load()
 	if err != nil {
-		log.Error(err.Error())
+		log.Fatal(err)
 	}
-	offset = clockOffset
 
-	log.Info("Clock Offset:", offset)
+	log.Info("Starting NTPClient to get offset")
+
+	ntpClient := &ntp.Client{Servers: cfg.NTP.Servers, Samples: cfg.NTP.Samples}
+	clockSync := ntpClient.StartResync(cfg.NTP.Resync, clock.Update)
+	defer clockSync.Stop()
+	if sample, ok, err := clockSync.Last(); ok {
+		log.Info("NTP Server:", sample.Server, " Delay:", sample.Delay)
+	} else {
+		log.Error("NTP sync failed, using system clock | ", err)
+	}
+	log.Info("NTP Offset:", clock.Offset(), " Uncertainty:", clock.Uncertainty())
+	log.Info("NTP Clock:", clock.Now())
 
 	const ClientID = "lapis-client-test-0"
-	const BrokerConfig = "ssl://mqtts.qz.sg:8883"
+	var BrokerConfig = cfg.Broker.URL
 
 	log.Info("Connecting to " + BrokerConfig)
 
@@ -121,8 +138,8 @@ func main() {
 
 	opts := mqtt.NewClientOptions().AddBroker(BrokerConfig).SetClientID(ClientID)
 	opts.SetTLSConfig(tlsConfig)
-	opts.SetUsername("bench")
-	opts.SetPassword("bench")
+	opts.SetUsername(cfg.Broker.Username)
+	opts.SetPassword(cfg.Broker.Password)
 	opts.SetDefaultPublishHandler(f)
 	topic := "sensor/+/data"
 
@@ -134,7 +151,7 @@ func main() {
 	}
 
 	go calcLatency()
-	if token := client.Subscribe(topic, 0, nil); token.Wait() && token.Error() != nil {
+	if token := client.Subscribe(topic, cfg.Broker.SubscribeQoS(), nil); token.Wait() && token.Error() != nil {
 		log.Error(token.Error())
 		os.Exit(1)
 	}
@@ -0,0 +1,568 @@
+package broker
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+	Minimal MQTT 3.1.1 broker for running everything on a single machine or lab network
+
+	Supports QoS 0, 1 and 2 from publishers, QoS 0 and 1 to subscribers (QoS 2 subscriptions are granted QoS 1),
+	a QoS 2 publish is routed on PUBLISH and its packet id remembered until PUBREL so retransmits are not routed again,
+	retained messages, wildcard subscriptions, last will and persistent sessions (clean session = false)
+	Messages for offline persistent sessions are queued, up to Options.QueueSize per session
+	QoS 1 messages stay in the session until PUBACK, a resumed persistent session is sent the unacknowledged ones again
+	with DUP set before anything queued while it was offline, up to Options.QueueSize unacknowledged messages are kept
+*/
+
+const (
+	connectTimeout = 10 * time.Second
+	writeTimeout   = 5 * time.Second
+	outboundDepth  = 1024
+)
+
+// Options : Broker settings
+type Options struct {
+	Username       string // Username required from clients unless AllowAnonymous
+	Password       string // Password required from clients unless AllowAnonymous
+	AllowAnonymous bool   // Accept clients regardless of credentials
+	QueueSize      int    // Max messages queued for an offline persistent session and max unacknowledged per session, defaults to 1000
+}
+
+// Broker : In process MQTT 3.1.1 broker
+type Broker struct {
+	opts Options
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	retained  map[string]*packets.PublishPacket
+	listeners []net.Listener
+	autoID    int
+	closed    bool
+}
+
+type session struct {
+	clientID   string
+	persistent bool
+	subs       map[string]byte // topic filter to granted QoS
+	conn       *conn           // nil while offline
+	queue      []*packets.PublishPacket
+	received   map[uint16]bool          // ids of QoS 2 publishes routed but not yet released by PUBREL
+	inflight   []*packets.PublishPacket // QoS 1 messages sent but not acknowledged, oldest first
+	nextID     uint16
+}
+
+type conn struct {
+	net.Conn
+	outbound chan packets.ControlPacket
+	done     chan struct{}
+	once     sync.Once
+}
+
+// New : Returns a Broker, call Serve, ListenAndServe or ListenAndServeTLS to accept clients
+func New(opts Options) *Broker {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.QueueSize > 0xffff-1 {
+		opts.QueueSize = 0xffff - 1 // leaves a free packet id however many messages are unacknowledged
+	}
+	return &Broker{
+		opts:     opts,
+		sessions: make(map[string]*session),
+		retained: make(map[string]*packets.PublishPacket),
+	}
+}
+
+// ListenAndServe : Accepts plain TCP MQTT clients on addr, ie: :1883
+func (b *Broker) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return b.Serve(l)
+}
+
+// ListenAndServeTLS : Accepts MQTT over TLS clients on addr, ie: :8883
+func (b *Broker) ListenAndServeTLS(addr string, certFile string, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	l, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return err
+	}
+	return b.Serve(l)
+}
+
+// Serve : Accepts MQTT clients on l until the Broker is closed
+func (b *Broker) Serve(l net.Listener) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		l.Close()
+		return errors.New("broker closed")
+	}
+	b.listeners = append(b.listeners, l)
+	b.mu.Unlock()
+
+	log.Info("MQTT Broker listening on ", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			b.mu.Lock()
+			closed := b.closed
+			b.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		go b.handle(c)
+	}
+}
+
+// Close : Stops all listeners and disconnects all clients
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, l := range b.listeners {
+		l.Close()
+	}
+	for _, s := range b.sessions {
+		if s.conn != nil {
+			s.conn.close()
+		}
+	}
+	return nil
+}
+
+func (b *Broker) handle(nc net.Conn) {
+	c := &conn{
+		Conn:     nc,
+		outbound: make(chan packets.ControlPacket, outboundDepth),
+		done:     make(chan struct{}),
+	}
+	defer c.close()
+
+	nc.SetReadDeadline(time.Now().Add(connectTimeout))
+	cp, err := packets.ReadPacket(nc)
+	if err != nil {
+		log.Debug("Broker | failed to read CONNECT from ", nc.RemoteAddr(), " | ", err)
+		return
+	}
+	connect, ok := cp.(*packets.ConnectPacket)
+	if !ok {
+		log.Warn("Broker | expected CONNECT from ", nc.RemoteAddr(), " got ", cp)
+		return
+	}
+
+	connack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	connack.ReturnCode = connect.Validate()
+	if connack.ReturnCode == packets.Accepted && !b.authenticate(connect) {
+		connack.ReturnCode = packets.ErrRefusedBadUsernameOrPassword
+	}
+	if connack.ReturnCode != packets.Accepted {
+		log.Warn("Broker | refused ", connect.ClientIdentifier, " from ", nc.RemoteAddr(), " | ", packets.ConnackReturnCodes[connack.ReturnCode])
+		connack.Write(nc)
+		return
+	}
+
+	go c.writeLoop()
+
+	s := b.attach(connect, c, connack)
+	log.Info("Broker | ", s.clientID, " connected from ", nc.RemoteAddr())
+
+	graceful := b.readLoop(s, c, time.Duration(connect.Keepalive)*time.Second*3/2)
+
+	if b.detach(s, c) {
+		log.Info("Broker | ", s.clientID, " disconnected")
+	}
+	if !graceful && connect.WillFlag {
+		will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		will.TopicName = connect.WillTopic
+		will.Payload = connect.WillMessage
+		will.Qos = connect.WillQos
+		will.Retain = connect.WillRetain
+		b.publish(will)
+	}
+}
+
+func (b *Broker) authenticate(connect *packets.ConnectPacket) bool {
+	if b.opts.AllowAnonymous {
+		return true
+	}
+	return connect.Username == b.opts.Username && string(connect.Password) == b.opts.Password
+}
+
+// attach : Binds c to the client's session, taking over any existing connection
+// Sends connack, then any messages queued while a resumed persistent session was offline
+func (b *Broker) attach(connect *packets.ConnectPacket, c *conn, connack *packets.ConnackPacket) *session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	clientID := connect.ClientIdentifier
+	if clientID == "" {
+		b.autoID++
+		clientID = fmt.Sprintf("lapis-broker-auto-%d", b.autoID)
+	}
+
+	s, ok := b.sessions[clientID]
+	if ok && s.conn != nil {
+		log.Info("Broker | ", clientID, " taken over by new connection")
+		s.conn.close()
+	}
+	present := ok && s.persistent && !connect.CleanSession
+	if !present {
+		s = &session{clientID: clientID, subs: make(map[string]byte), received: make(map[uint16]bool)}
+		b.sessions[clientID] = s
+	}
+	s.persistent = !connect.CleanSession
+	s.conn = c
+
+	connack.SessionPresent = present
+	c.send(connack)
+	if len(s.inflight) > 0 {
+		log.Info("Broker | resending ", len(s.inflight), " unacknowledged messages to ", clientID)
+	}
+	for i, p := range s.inflight {
+		// Copied as the previous connection may still be writing p
+		dup := p.Copy()
+		dup.Qos = p.Qos
+		dup.MessageID = p.MessageID
+		dup.Dup = true
+		s.inflight[i] = dup
+		if !c.send(dup) {
+			log.Warn("Broker | outbound queue full for ", clientID, ", message ", dup.MessageID, " resent on its next reconnect")
+		}
+	}
+	for _, p := range s.queue {
+		b.deliver(s, p)
+	}
+	s.queue = nil
+	return s
+}
+
+// detach : Unbinds c from s, non persistent sessions are discarded
+// Returns false if c had already been replaced by a newer connection
+func (b *Broker) detach(s *session, c *conn) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s.conn != c {
+		return false
+	}
+	s.conn = nil
+	if !s.persistent {
+		delete(b.sessions, s.clientID)
+	}
+	return true
+}
+
+// readLoop : Handles packets from c until it disconnects, returns true if client sent DISCONNECT
+func (b *Broker) readLoop(s *session, c *conn, keepalive time.Duration) bool {
+	for {
+		if keepalive > 0 {
+			c.SetReadDeadline(time.Now().Add(keepalive))
+		} else {
+			c.SetReadDeadline(time.Time{})
+		}
+		cp, err := packets.ReadPacket(c)
+		if err != nil {
+			return false
+		}
+
+		switch p := cp.(type) {
+		case *packets.PublishPacket:
+			switch p.Qos {
+			case 1:
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				c.send(puback)
+			case 2:
+				pubrec := packets.NewControlPacket(packets.Pubrec).(*packets.PubrecPacket)
+				pubrec.MessageID = p.MessageID
+				c.send(pubrec)
+				if !b.receive(s, p.MessageID) {
+					log.Debug("Broker | ", s.clientID, " resent QoS 2 message ", p.MessageID, ", already routed")
+					continue
+				}
+			}
+			b.publish(p)
+		case *packets.PubrelPacket:
+			b.mu.Lock()
+			delete(s.received, p.MessageID)
+			b.mu.Unlock()
+			pubcomp := packets.NewControlPacket(packets.Pubcomp).(*packets.PubcompPacket)
+			pubcomp.MessageID = p.MessageID
+			c.send(pubcomp)
+		case *packets.PubackPacket:
+			b.mu.Lock()
+			s.ack(p.MessageID)
+			b.mu.Unlock()
+		case *packets.PubrecPacket, *packets.PubcompPacket:
+			// Outbound messages are at most QoS 1, nothing to do
+		case *packets.SubscribePacket:
+			b.subscribe(s, c, p)
+		case *packets.UnsubscribePacket:
+			b.mu.Lock()
+			for _, filter := range p.Topics {
+				delete(s.subs, filter)
+			}
+			b.mu.Unlock()
+			unsuback := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+			unsuback.MessageID = p.MessageID
+			c.send(unsuback)
+		case *packets.PingreqPacket:
+			c.send(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return true
+		default:
+			log.Warn("Broker | unexpected packet from ", s.clientID, " | ", cp)
+			return false
+		}
+	}
+}
+
+// receive : Remembers QoS 2 packet id until PUBREL, returns false if it was already received
+func (b *Broker) receive(s *session, id uint16) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s.received[id] {
+		return false
+	}
+	s.received[id] = true
+	return true
+}
+
+func (b *Broker) subscribe(s *session, c *conn, p *packets.SubscribePacket) {
+	suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	suback.MessageID = p.MessageID
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, filter := range p.Topics {
+		if !validFilter(filter) {
+			suback.ReturnCodes = append(suback.ReturnCodes, 0x80)
+			continue
+		}
+		granted := p.Qoss[i]
+		if granted > 1 {
+			granted = 1
+		}
+		s.subs[filter] = granted
+		suback.ReturnCodes = append(suback.ReturnCodes, granted)
+		log.Debug("Broker | ", s.clientID, " subscribed to ", filter, " QoS ", granted)
+	}
+	c.send(suback)
+
+	for topic, retained := range b.retained {
+		for i, filter := range p.Topics {
+			if suback.ReturnCodes[i] != 0x80 && match(filter, topic) {
+				out := retained.Copy()
+				out.Retain = true
+				out.Qos = minQoS(retained.Qos, suback.ReturnCodes[i])
+				b.deliver(s, out)
+				break
+			}
+		}
+	}
+}
+
+// publish : Routes p to all matching subscriptions and updates retained messages
+func (b *Broker) publish(p *packets.PublishPacket) {
+	if !validTopic(p.TopicName) {
+		log.Warn("Broker | dropping publish to invalid topic ", p.TopicName)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			retained := p.Copy()
+			retained.Qos = p.Qos
+			b.retained[p.TopicName] = retained
+		}
+	}
+
+	for _, s := range b.sessions {
+		granted, ok := s.matches(p.TopicName)
+		if !ok {
+			continue
+		}
+		out := p.Copy()
+		out.Retain = false
+		out.Qos = minQoS(p.Qos, granted)
+		if s.conn != nil {
+			b.deliver(s, out)
+		} else if out.Qos > 0 {
+			if len(s.queue) >= b.opts.QueueSize {
+				s.queue = s.queue[1:]
+			}
+			s.queue = append(s.queue, out)
+		}
+	}
+}
+
+// deliver : Sends p to the connected client of s, caller must hold b.mu
+// QoS 1 messages are kept until acknowledged, so one that did not fit the outbound queue is resent on reconnect
+func (b *Broker) deliver(s *session, p *packets.PublishPacket) {
+	if p.Qos > 0 {
+		if len(s.inflight) >= b.opts.QueueSize {
+			log.Warn("Broker | ", s.clientID, " has ", len(s.inflight), " unacknowledged messages, dropping oldest on ", s.inflight[0].TopicName)
+			s.inflight = s.inflight[1:]
+		}
+		p.MessageID = s.newID()
+		s.inflight = append(s.inflight, p)
+	}
+	if !s.conn.send(p) {
+		if p.Qos > 0 && s.persistent {
+			log.Warn("Broker | outbound queue full for ", s.clientID, ", message on ", p.TopicName, " resent on its next reconnect")
+		} else {
+			log.Warn("Broker | outbound queue full for ", s.clientID, ", dropping message on ", p.TopicName)
+		}
+	}
+}
+
+// matches : Returns highest granted QoS among the subscriptions of s matching topic
+func (s *session) matches(topic string) (byte, bool) {
+	var granted byte
+	found := false
+	for filter, qos := range s.subs {
+		if match(filter, topic) {
+			found = true
+			if qos > granted {
+				granted = qos
+			}
+		}
+	}
+	return granted, found
+}
+
+func (c *conn) send(p packets.ControlPacket) bool {
+	select {
+	case c.outbound <- p:
+		return true
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) writeLoop() {
+	for {
+		select {
+		case p := <-c.outbound:
+			c.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := p.Write(c.Conn); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+// newID : Returns a packet id not used by any unacknowledged message, caller must hold b.mu
+func (s *session) newID() uint16 {
+	for {
+		s.nextID++
+		if s.nextID == 0 {
+			s.nextID = 1
+		}
+		if !s.inUse(s.nextID) {
+			return s.nextID
+		}
+	}
+}
+
+func (s *session) inUse(id uint16) bool {
+	for _, p := range s.inflight {
+		if p.MessageID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ack : Forgets the unacknowledged message id, caller must hold b.mu
+func (s *session) ack(id uint16) {
+	for i, p := range s.inflight {
+		if p.MessageID == id {
+			s.inflight = append(s.inflight[:i], s.inflight[i+1:]...)
+			return
+		}
+	}
+}
+
+func minQoS(a byte, b byte) byte {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// match : Returns true if topic matches filter, supports + and # wildcards
+func match(filter string, topic string) bool {
+	// Wildcards do not match topics starting with $
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+func validFilter(filter string) bool {
+	if filter == "" {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return false
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return false
+		}
+	}
+	return true
+}
+
+func validTopic(topic string) bool {
+	return topic != "" && !strings.ContainsAny(topic, "+#")
+}
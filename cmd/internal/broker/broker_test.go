@@ -0,0 +1,416 @@
+package broker
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+var matchTests = []struct {
+	filter string
+	topic  string
+	want   bool
+}{
+	{"sensor/1/data", "sensor/1/data", true},
+	{"sensor/1/data", "sensor/2/data", false},
+	{"sensor/+/data", "sensor/1/data", true},
+	{"sensor/+/data", "sensor/1/batch", false},
+	{"sensor/+/data", "sensor//data", true},
+	{"sensor/+", "sensor/1/data", false},
+	{"sensor/+/+", "sensor/1/data", true},
+	{"+/+/data", "sensor/1/data", true},
+	{"sensor/#", "sensor/1/data", true},
+	{"sensor/#", "sensor", true},
+	{"sensor/#", "sensors/1", false},
+	{"#", "sensor/1/data", true},
+	{"#", "$SYS/uptime", false},
+	{"+/uptime", "$SYS/uptime", false},
+	{"$SYS/#", "$SYS/uptime", true},
+	{"a/b", "a/b/c", false},
+	{"a/b/c", "a/b", false},
+	{"a/b", "a/b/", false},
+	{"a/b/+", "a/b/", true},
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range matchTests {
+		if got := match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+var validFilterTests = []struct {
+	filter string
+	want   bool
+}{
+	{"", false},
+	{"sensor/1/data", true},
+	{"#", true},
+	{"+", true},
+	{"sensor/#", true},
+	{"sensor/+/data", true},
+	{"+/+/#", true},
+	{"sensor/#/data", false},
+	{"sensor#", false},
+	{"sensor/data#", false},
+	{"sensor+", false},
+	{"sensor/+data", false},
+	{"##", false},
+}
+
+func TestValidFilter(t *testing.T) {
+	for _, tt := range validFilterTests {
+		if got := validFilter(tt.filter); got != tt.want {
+			t.Errorf("validFilter(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestValidTopic(t *testing.T) {
+	for topic, want := range map[string]bool{"sensor/1/data": true, "": false, "sensor/+/data": false, "sensor/#": false} {
+		if got := validTopic(topic); got != want {
+			t.Errorf("validTopic(%q) = %v, want %v", topic, got, want)
+		}
+	}
+}
+
+// startBroker : Serves b on a loopback port until the test ends
+func startBroker(t *testing.T, opts Options) (*Broker, string) {
+	t.Helper()
+	b := New(opts)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.Serve(l)
+	t.Cleanup(func() { b.Close() })
+	return b, l.Addr().String()
+}
+
+type testClient struct {
+	net.Conn
+	t *testing.T
+}
+
+// dial : Sends connect and returns the client with its CONNACK
+func dial(t *testing.T, addr string, connect *packets.ConnectPacket) (*testClient, *packets.ConnackPacket) {
+	t.Helper()
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testClient{Conn: nc, t: t}
+	t.Cleanup(func() { nc.Close() })
+	c.write(connect)
+	connack, ok := c.read().(*packets.ConnackPacket)
+	if !ok {
+		t.Fatalf("%s: expected CONNACK", connect.ClientIdentifier)
+	}
+	return c, connack
+}
+
+func newConnect(clientID string, cleanSession bool) *packets.ConnectPacket {
+	connect := packets.NewControlPacket(packets.Connect).(*packets.ConnectPacket)
+	connect.ProtocolName = "MQTT"
+	connect.ProtocolVersion = 4
+	connect.ClientIdentifier = clientID
+	connect.CleanSession = cleanSession
+	connect.Keepalive = 30
+	return connect
+}
+
+// connect : Connects clientID to a broker accepting anonymous clients
+func connect(t *testing.T, addr string, clientID string, cleanSession bool) *testClient {
+	t.Helper()
+	c, connack := dial(t, addr, newConnect(clientID, cleanSession))
+	if connack.ReturnCode != packets.Accepted {
+		t.Fatalf("%s: CONNACK return code %d", clientID, connack.ReturnCode)
+	}
+	return c
+}
+
+func (c *testClient) write(p packets.ControlPacket) {
+	c.t.Helper()
+	c.SetWriteDeadline(time.Now().Add(time.Second))
+	if err := p.Write(c.Conn); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) read() packets.ControlPacket {
+	c.t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	p, err := packets.ReadPacket(c.Conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return p
+}
+
+// readPublish : Reads the next packet, which must be a PUBLISH
+func (c *testClient) readPublish() *packets.PublishPacket {
+	c.t.Helper()
+	p := c.read()
+	publish, ok := p.(*packets.PublishPacket)
+	if !ok {
+		c.t.Fatalf("expected PUBLISH, got %v", p)
+	}
+	return publish
+}
+
+// expectNothing : Fails if a packet arrives within a short wait
+func (c *testClient) expectNothing() {
+	c.t.Helper()
+	c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if p, err := packets.ReadPacket(c.Conn); err == nil {
+		c.t.Fatalf("expected nothing, got %v", p)
+	}
+}
+
+func (c *testClient) subscribe(filter string, qos byte) {
+	c.t.Helper()
+	sub := packets.NewControlPacket(packets.Subscribe).(*packets.SubscribePacket)
+	sub.MessageID = 1
+	sub.Topics = []string{filter}
+	sub.Qoss = []byte{qos}
+	c.write(sub)
+	suback, ok := c.read().(*packets.SubackPacket)
+	if !ok || len(suback.ReturnCodes) != 1 || suback.ReturnCodes[0] == 0x80 {
+		c.t.Fatalf("subscribe %s failed", filter)
+	}
+}
+
+func (c *testClient) publish(topic string, payload string, qos byte, id uint16, retain bool) {
+	c.t.Helper()
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName = topic
+	p.Payload = []byte(payload)
+	p.Qos = qos
+	p.MessageID = id
+	p.Retain = retain
+	c.write(p)
+}
+
+func (c *testClient) puback(id uint16) {
+	c.t.Helper()
+	puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+	puback.MessageID = id
+	c.write(puback)
+}
+
+// waitOffline : Waits until the broker has detached the connection of clientID
+func waitOffline(t *testing.T, b *Broker, clientID string) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		b.mu.Lock()
+		s, ok := b.sessions[clientID]
+		offline := !ok || s.conn == nil
+		b.mu.Unlock()
+		if offline {
+			return
+		}
+	}
+	t.Fatalf("%s still connected", clientID)
+}
+
+func TestAuthentication(t *testing.T) {
+	_, addr := startBroker(t, Options{Username: "bench", Password: "bench"})
+
+	for _, tt := range []struct {
+		username string
+		password string
+		want     byte
+	}{
+		{"bench", "bench", packets.Accepted},
+		{"bench", "wrong", packets.ErrRefusedBadUsernameOrPassword},
+		{"", "", packets.ErrRefusedBadUsernameOrPassword},
+	} {
+		connect := newConnect("auth", true)
+		if tt.username != "" {
+			connect.UsernameFlag = true
+			connect.Username = tt.username
+			connect.PasswordFlag = true
+			connect.Password = []byte(tt.password)
+		}
+		c, connack := dial(t, addr, connect)
+		if connack.ReturnCode != tt.want {
+			t.Errorf("%q/%q: CONNACK return code %d, want %d", tt.username, tt.password, connack.ReturnCode, tt.want)
+		}
+		c.Close()
+	}
+}
+
+func TestQoS2RoutedOnceUntilPubrel(t *testing.T) {
+	_, addr := startBroker(t, Options{AllowAnonymous: true})
+	sub := connect(t, addr, "sub", true)
+	sub.subscribe("sensor/+/data", 1)
+	pub := connect(t, addr, "pub", true)
+
+	// Publisher did not see the PUBREC and resends, the message must only be routed once
+	for i := 0; i < 2; i++ {
+		pub.publish("sensor/1/data", "reading", 2, 7, false)
+		if pubrec, ok := pub.read().(*packets.PubrecPacket); !ok || pubrec.MessageID != 7 {
+			t.Fatalf("publish %d: expected PUBREC 7", i)
+		}
+	}
+	got := sub.readPublish()
+	if string(got.Payload) != "reading" || got.Qos != 1 {
+		t.Errorf("subscriber got %q QoS %d, want %q QoS 1", got.Payload, got.Qos, "reading")
+	}
+	sub.puback(got.MessageID)
+	sub.expectNothing()
+
+	pubrel := packets.NewControlPacket(packets.Pubrel).(*packets.PubrelPacket)
+	pubrel.MessageID = 7
+	pub.write(pubrel)
+	if pubcomp, ok := pub.read().(*packets.PubcompPacket); !ok || pubcomp.MessageID != 7 {
+		t.Fatal("expected PUBCOMP 7")
+	}
+
+	// Released, so the id is free for a new message
+	pub.publish("sensor/1/data", "next", 2, 7, false)
+	pub.read()
+	if got := sub.readPublish(); string(got.Payload) != "next" {
+		t.Errorf("subscriber got %q after PUBREL, want %q", got.Payload, "next")
+	}
+}
+
+func TestInflightResentOnResume(t *testing.T) {
+	b, addr := startBroker(t, Options{AllowAnonymous: true})
+	sub := connect(t, addr, "sub", false)
+	sub.subscribe("sensor/#", 1)
+	pub := connect(t, addr, "pub", true)
+
+	pub.publish("sensor/1/data", "unacked", 1, 1, false)
+	pub.read()
+	first := sub.readPublish()
+	if first.Dup {
+		t.Error("first delivery has DUP set")
+	}
+	// Subscriber drops without acknowledging, a message arrives while it is offline
+	sub.Close()
+	waitOffline(t, b, "sub")
+	pub.publish("sensor/2/data", "queued", 1, 2, false)
+	pub.read()
+
+	sub, connack := dial(t, addr, newConnect("sub", false))
+	if !connack.SessionPresent {
+		t.Error("resumed session not reported present")
+	}
+	resent := sub.readPublish()
+	if !resent.Dup || resent.MessageID != first.MessageID || string(resent.Payload) != "unacked" {
+		t.Errorf("resent %q id %d dup %v, want %q id %d dup true", resent.Payload, resent.MessageID, resent.Dup, "unacked", first.MessageID)
+	}
+	queued := sub.readPublish()
+	if queued.Dup || string(queued.Payload) != "queued" {
+		t.Errorf("queued %q dup %v, want %q dup false", queued.Payload, queued.Dup, "queued")
+	}
+	if queued.MessageID == resent.MessageID {
+		t.Errorf("queued message reuses unacknowledged id %d", queued.MessageID)
+	}
+
+	// Both acknowledged, nothing is resent on the next resume
+	sub.puback(resent.MessageID)
+	sub.puback(queued.MessageID)
+	sub.expectNothing()
+	sub.Close()
+	waitOffline(t, b, "sub")
+	sub = connect(t, addr, "sub", false)
+	sub.expectNothing()
+}
+
+func TestCleanSessionDiscardsInflight(t *testing.T) {
+	b, addr := startBroker(t, Options{AllowAnonymous: true})
+	sub := connect(t, addr, "sub", false)
+	sub.subscribe("sensor/#", 1)
+	pub := connect(t, addr, "pub", true)
+	pub.publish("sensor/1/data", "unacked", 1, 1, false)
+	pub.read()
+	sub.readPublish()
+	sub.Close()
+	waitOffline(t, b, "sub")
+
+	sub, connack := dial(t, addr, newConnect("sub", true))
+	if connack.SessionPresent {
+		t.Error("clean session reported present")
+	}
+	sub.expectNothing()
+}
+
+func TestRetained(t *testing.T) {
+	_, addr := startBroker(t, Options{AllowAnonymous: true})
+	pub := connect(t, addr, "pub", true)
+	pub.publish("sensor/1/data", "last", 1, 1, true)
+	pub.read()
+	pub.publish("sensor/2/data", "cleared", 0, 0, true)
+	pub.publish("sensor/2/data", "", 0, 0, true)
+
+	sub := connect(t, addr, "sub", true)
+	sub.subscribe("sensor/+/data", 1)
+	got := sub.readPublish()
+	if !got.Retain || string(got.Payload) != "last" || got.TopicName != "sensor/1/data" {
+		t.Errorf("retained %s %q retain %v, want sensor/1/data %q retain true", got.TopicName, got.Payload, got.Retain, "last")
+	}
+	sub.puback(got.MessageID)
+	sub.expectNothing()
+
+	// Live messages are forwarded without the retain flag
+	pub.publish("sensor/1/data", "live", 0, 0, true)
+	if got := sub.readPublish(); got.Retain || string(got.Payload) != "live" {
+		t.Errorf("live %q retain %v, want %q retain false", got.Payload, got.Retain, "live")
+	}
+}
+
+func TestWill(t *testing.T) {
+	for _, graceful := range []bool{false, true} {
+		_, addr := startBroker(t, Options{AllowAnonymous: true})
+		sub := connect(t, addr, "sub", true)
+		sub.subscribe("status/#", 1)
+
+		will := newConnect("dancer", true)
+		will.WillFlag = true
+		will.WillTopic = "status/dancer"
+		will.WillMessage = []byte("offline")
+		will.WillQos = 1
+		c, _ := dial(t, addr, will)
+		if graceful {
+			c.write(packets.NewControlPacket(packets.Disconnect))
+		}
+		c.Close()
+
+		if graceful {
+			sub.expectNothing()
+			continue
+		}
+		got := sub.readPublish()
+		if got.TopicName != "status/dancer" || string(got.Payload) != "offline" {
+			t.Errorf("will %s %q, want status/dancer %q", got.TopicName, got.Payload, "offline")
+		}
+	}
+}
+
+func TestSessionTakeover(t *testing.T) {
+	_, addr := startBroker(t, Options{AllowAnonymous: true})
+	old := connect(t, addr, "dancer", false)
+	old.subscribe("sensor/#", 1)
+	c := connect(t, addr, "dancer", false)
+
+	old.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if p, err := packets.ReadPacket(old.Conn); err == nil {
+		t.Fatalf("old connection still open, got %v", p)
+	}
+
+	// New connection took over the persistent session including its subscription
+	c.write(packets.NewControlPacket(packets.Pingreq))
+	if _, ok := c.read().(*packets.PingrespPacket); !ok {
+		t.Fatal("expected PINGRESP")
+	}
+	pub := connect(t, addr, "pub", true)
+	pub.publish("sensor/1/data", "reading", 0, 0, false)
+	if got := c.readPublish(); string(got.Payload) != "reading" {
+		t.Errorf("got %q, want %q", got.Payload, "reading")
+	}
+}
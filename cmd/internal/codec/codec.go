@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Padding : Scheme used to pad plaintext to the AES block size
+type Padding int
+
+// Padding schemes
+const (
+	SpacePadding Padding = iota // pads with spaces, what eval_server.py expects, trailing spaces of the plaintext are lost on decrypt
+	PKCS7Padding                // pads with n bytes of value n, always adds at least one byte
+)
+
+// Errors returned by Decrypt
+var (
+	ErrMalformed  = errors.New("codec: message too short or not block aligned")
+	ErrBadPadding = errors.New("codec: invalid padding")
+)
+
+func (p Padding) String() string {
+	switch p {
+	case SpacePadding:
+		return "space"
+	case PKCS7Padding:
+		return "pkcs7"
+	}
+	return fmt.Sprintf("Padding(%d)", int(p))
+}
+
+// ParsePadding : Returns Padding named s, space or pkcs7
+func ParsePadding(s string) (Padding, error) {
+	switch strings.ToLower(s) {
+	case "space":
+		return SpacePadding, nil
+	case "pkcs7":
+		return PKCS7Padding, nil
+	}
+	return SpacePadding, fmt.Errorf("unknown padding %q, expected space or pkcs7", s)
+}
+
+// Pad : Pads src to a multiple of blockSize
+func Pad(src []byte, blockSize int, padding Padding) []byte {
+	n := blockSize - len(src)%blockSize
+	padByte := byte(' ')
+	if padding == PKCS7Padding {
+		padByte = byte(n)
+	}
+	return append(src, bytes.Repeat([]byte{padByte}, n)...)
+}
+
+// Unpad : Removes padding added by Pad
+func Unpad(src []byte, blockSize int, padding Padding) ([]byte, error) {
+	if len(src) == 0 || len(src)%blockSize != 0 {
+		return nil, ErrBadPadding
+	}
+	if padding == SpacePadding {
+		return bytes.TrimRight(src, " "), nil
+	}
+	n := int(src[len(src)-1])
+	if n == 0 || n > blockSize {
+		return nil, ErrBadPadding
+	}
+	for _, b := range src[len(src)-n:] {
+		if int(b) != n {
+			return nil, ErrBadPadding
+		}
+	}
+	return src[:len(src)-n], nil
+}
+
+// Cipher : Encrypts and decrypts eval server messages
+type Cipher interface {
+	Encrypt(plaintext []byte) (string, error)
+	Decrypt(msg string) ([]byte, error)
+}
+
+// Mode : Cipher mode used on the eval server link
+type Mode int
+
+// Cipher modes
+const (
+	CBCMode Mode = iota // legacy AES-CBC, base64(IV | ciphertext), what eval_server.py expects
+	GCMMode             // AES-GCM, base64(version | nonce | ciphertext | tag)
+)
+
+func (m Mode) String() string {
+	switch m {
+	case CBCMode:
+		return "cbc"
+	case GCMMode:
+		return "gcm"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode : Returns Mode named s, cbc or gcm
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "cbc":
+		return CBCMode, nil
+	case "gcm":
+		return GCMMode, nil
+	}
+	return CBCMode, fmt.Errorf("unknown cipher mode %q, expected cbc or gcm", s)
+}
+
+// NewCipher : Returns the Cipher for mode, padding is only used by CBCMode
+func NewCipher(mode Mode, key []byte, padding Padding) (Cipher, error) {
+	switch mode {
+	case CBCMode:
+		c, err := New(key, padding)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case GCMMode:
+		g, err := NewGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+	return nil, fmt.Errorf("codec: unknown mode %v", mode)
+}
+
+// Codec : AES-CBC codec for eval server messages
+// Messages are base64(IV | ciphertext) with a random 16 byte IV
+type Codec struct {
+	block   cipher.Block
+	padding Padding
+}
+
+// New : Returns a Codec, key must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256
+func New(key []byte, padding Padding) (*Codec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{block: block, padding: padding}, nil
+}
+
+// Padding : Returns padding scheme of c
+func (c *Codec) Padding() Padding {
+	return c.padding
+}
+
+// Encrypt : Pads and encrypts plaintext with a fresh IV from crypto/rand
+func (c *Codec) Encrypt(plaintext []byte) (string, error) {
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", fmt.Errorf("codec: generating IV: %v", err)
+	}
+	data := Pad(append([]byte(nil), plaintext...), aes.BlockSize, c.padding)
+	ciphertext := make([]byte, aes.BlockSize+len(data))
+	copy(ciphertext, iv)
+	cipher.NewCBCEncrypter(c.block, iv).CryptBlocks(ciphertext[aes.BlockSize:], data)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt : Reverses Encrypt
+func (c *Codec) Decrypt(msg string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(msg))
+	if err != nil {
+		return nil, fmt.Errorf("codec: %v", err)
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, ErrMalformed
+	}
+	iv, ciphertext := data[:aes.BlockSize], data[aes.BlockSize:]
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(c.block, iv).CryptBlocks(plaintext, ciphertext)
+	return Unpad(plaintext, aes.BlockSize, c.padding)
+}
@@ -0,0 +1,325 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+// plaintexts : Messages round tripped by every cipher, including ones ending on a block boundary
+var plaintexts = []string{
+	"",
+	"#1 2 3|rocket|1.52",
+	"0123456789abcdef",
+	"#1 2 3 4 5 6 7 8|windowwipe|0.25|rocket rocket hair",
+}
+
+// encryptRaw : CBC encrypts block aligned data as is, to craft messages with arbitrary padding
+func encryptRaw(t *testing.T, data []byte) string {
+	t.Helper()
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, aes.BlockSize)
+	out := make([]byte, aes.BlockSize+len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out[aes.BlockSize:], data)
+	return base64.StdEncoding.EncodeToString(out)
+}
+
+func TestCBCRoundTrip(t *testing.T) {
+	for _, padding := range []Padding{SpacePadding, PKCS7Padding} {
+		c, err := New(testKey, padding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range plaintexts {
+			msg, err := c.Encrypt([]byte(p))
+			if err != nil {
+				t.Fatalf("%v: Encrypt(%q) error = %v", padding, p, err)
+			}
+			got, err := c.Decrypt(msg)
+			if err != nil {
+				t.Fatalf("%v: Decrypt(Encrypt(%q)) error = %v", padding, p, err)
+			}
+			if string(got) != p {
+				t.Errorf("%v: Decrypt(Encrypt(%q)) = %q", padding, p, got)
+			}
+		}
+	}
+}
+
+func TestCBCFreshIV(t *testing.T) {
+	c, _ := New(testKey, SpacePadding)
+	a, _ := c.Encrypt([]byte("#1 2 3|rocket|1.52"))
+	b, _ := c.Encrypt([]byte("#1 2 3|rocket|1.52"))
+	if a == b {
+		t.Error("Encrypt returned the same message twice, IV is not random")
+	}
+}
+
+func TestSpacePaddingTrimsTrailingSpaces(t *testing.T) {
+	c, _ := New(testKey, SpacePadding)
+	msg, _ := c.Encrypt([]byte("#1 2 3|rocket  "))
+	got, err := c.Decrypt(msg)
+	if err != nil || string(got) != "#1 2 3|rocket" {
+		t.Errorf("Decrypt = %q, %v, want %q", got, err, "#1 2 3|rocket")
+	}
+}
+
+func TestPKCS7KeepsTrailingSpaces(t *testing.T) {
+	c, _ := New(testKey, PKCS7Padding)
+	msg, _ := c.Encrypt([]byte("#1 2 3|rocket  "))
+	got, err := c.Decrypt(msg)
+	if err != nil || string(got) != "#1 2 3|rocket  " {
+		t.Errorf("Decrypt = %q, %v, want %q", got, err, "#1 2 3|rocket  ")
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		src     string
+		padding Padding
+		want    string
+	}{
+		{"abc", SpacePadding, "abc" + string(bytes.Repeat([]byte{' '}, 13))},
+		{"abc", PKCS7Padding, "abc" + string(bytes.Repeat([]byte{13}, 13))},
+		{"0123456789abcdef", PKCS7Padding, "0123456789abcdef" + string(bytes.Repeat([]byte{16}, 16))},
+		{"", PKCS7Padding, string(bytes.Repeat([]byte{16}, 16))},
+	}
+	for _, tt := range tests {
+		if got := Pad([]byte(tt.src), aes.BlockSize, tt.padding); string(got) != tt.want {
+			t.Errorf("Pad(%q, %v) = %q, want %q", tt.src, tt.padding, got, tt.want)
+		}
+	}
+}
+
+func TestBadPKCS7Padding(t *testing.T) {
+	c, _ := New(testKey, PKCS7Padding)
+	body := []byte("0123456789ab")
+	tests := []struct {
+		name string
+		tail []byte // last 4 bytes of the single block
+	}{
+		{"zero", []byte{4, 4, 4, 0}},
+		{"longer than block", []byte{4, 4, 4, 17}},
+		{"inconsistent", []byte{4, 3, 4, 4}},
+		{"space padded", []byte("    ")},
+	}
+	for _, tt := range tests {
+		msg := encryptRaw(t, append(append([]byte(nil), body...), tt.tail...))
+		if _, err := c.Decrypt(msg); err != ErrBadPadding {
+			t.Errorf("%s: Decrypt error = %v, want %v", tt.name, err, ErrBadPadding)
+		}
+	}
+
+	if _, err := Unpad([]byte("abc"), aes.BlockSize, PKCS7Padding); err != ErrBadPadding {
+		t.Errorf("Unpad of unaligned input error = %v, want %v", err, ErrBadPadding)
+	}
+	if _, err := Unpad(nil, aes.BlockSize, PKCS7Padding); err != ErrBadPadding {
+		t.Errorf("Unpad of empty input error = %v, want %v", err, ErrBadPadding)
+	}
+}
+
+func TestCBCMalformed(t *testing.T) {
+	c, _ := New(testKey, PKCS7Padding)
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"empty", ""},
+		{"iv only", base64.StdEncoding.EncodeToString(make([]byte, aes.BlockSize))},
+		{"shorter than iv", base64.StdEncoding.EncodeToString(make([]byte, 10))},
+		{"not block aligned", base64.StdEncoding.EncodeToString(make([]byte, 2*aes.BlockSize+5))},
+	}
+	for _, tt := range tests {
+		if _, err := c.Decrypt(tt.msg); err != ErrMalformed {
+			t.Errorf("%s: Decrypt error = %v, want %v", tt.name, err, ErrMalformed)
+		}
+	}
+}
+
+func TestBadBase64(t *testing.T) {
+	c, _ := New(testKey, SpacePadding)
+	g, _ := NewGCM(testKey)
+	for _, msg := range []string{"not base64!", "QUJD=", "#1 2 3|rocket|1.52"} {
+		if _, err := c.Decrypt(msg); err == nil || err == ErrMalformed || err == ErrBadPadding {
+			t.Errorf("CBC Decrypt(%q) error = %v, want a base64 error", msg, err)
+		}
+		if _, err := g.Decrypt(msg); err == nil || err == ErrMalformed || err == ErrAuthFailed {
+			t.Errorf("GCM Decrypt(%q) error = %v, want a base64 error", msg, err)
+		}
+	}
+}
+
+func TestDecryptTrimsWhitespace(t *testing.T) {
+	c, _ := New(testKey, PKCS7Padding)
+	msg, _ := c.Encrypt([]byte("#1 2 3|rocket|1.52"))
+	if got, err := c.Decrypt(" " + msg + "\n"); err != nil || string(got) != "#1 2 3|rocket|1.52" {
+		t.Errorf("Decrypt = %q, %v", got, err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	for _, key := range [][]byte{nil, []byte("short"), make([]byte, 17)} {
+		if _, err := New(key, SpacePadding); err == nil {
+			t.Errorf("New with %d byte key returned no error", len(key))
+		}
+		if _, err := NewGCM(key); err == nil {
+			t.Errorf("NewGCM with %d byte key returned no error", len(key))
+		}
+	}
+	for _, n := range []int{16, 24, 32} {
+		if _, err := New(make([]byte, n), SpacePadding); err != nil {
+			t.Errorf("New with %d byte key error = %v", n, err)
+		}
+	}
+}
+
+func TestGCMRoundTrip(t *testing.T) {
+	g, err := NewGCM(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range plaintexts {
+		msg, err := g.Encrypt([]byte(p))
+		if err != nil {
+			t.Fatalf("Encrypt(%q) error = %v", p, err)
+		}
+		got, err := g.Decrypt(msg)
+		if err != nil {
+			t.Fatalf("Decrypt(Encrypt(%q)) error = %v", p, err)
+		}
+		if string(got) != p {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q", p, got)
+		}
+	}
+
+	a, _ := g.Encrypt([]byte("#1 2 3|rocket|1.52"))
+	b, _ := g.Encrypt([]byte("#1 2 3|rocket|1.52"))
+	if a == b {
+		t.Error("Encrypt returned the same message twice, nonce is not random")
+	}
+}
+
+// sealed : Returns the decoded envelope of plaintext
+func sealed(t *testing.T, g *GCM, plaintext string) []byte {
+	t.Helper()
+	msg, err := g.Encrypt([]byte(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := base64.StdEncoding.DecodeString(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func TestGCMTampered(t *testing.T) {
+	g, _ := NewGCM(testKey)
+	nonceSize := 12
+	tests := []struct {
+		name string
+		at   func(n int) int // index of the byte to flip in an envelope of n bytes
+	}{
+		{"nonce", func(n int) int { return 1 }},
+		{"ciphertext", func(n int) int { return 1 + nonceSize }},
+		{"tag", func(n int) int { return n - 1 }},
+	}
+	for _, tt := range tests {
+		envelope := sealed(t, g, "#1 2 3|rocket|1.52")
+		envelope[tt.at(len(envelope))] ^= 0x01
+		if _, err := g.Decrypt(base64.StdEncoding.EncodeToString(envelope)); err != ErrAuthFailed {
+			t.Errorf("%s: Decrypt error = %v, want %v", tt.name, err, ErrAuthFailed)
+		}
+	}
+
+	envelope := sealed(t, g, "#1 2 3|rocket|1.52")
+	other, _ := NewGCM([]byte("fedcba9876543210"))
+	if _, err := other.Decrypt(base64.StdEncoding.EncodeToString(envelope)); err != ErrAuthFailed {
+		t.Errorf("Decrypt with another key error = %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestGCMUnknownVersion(t *testing.T) {
+	g, _ := NewGCM(testKey)
+	for _, version := range []byte{0, 2, 0xff} {
+		envelope := sealed(t, g, "#1 2 3|rocket|1.52")
+		envelope[0] = version
+		if _, err := g.Decrypt(base64.StdEncoding.EncodeToString(envelope)); err != ErrUnsupportedVersion {
+			t.Errorf("version %d: Decrypt error = %v, want %v", version, err, ErrUnsupportedVersion)
+		}
+	}
+}
+
+func TestGCMMalformed(t *testing.T) {
+	g, _ := NewGCM(testKey)
+	envelope := sealed(t, g, "")
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"empty", nil},
+		{"version only", []byte{EnvelopeV1}},
+		{"missing tag byte", envelope[:len(envelope)-1]},
+	}
+	for _, tt := range tests {
+		if _, err := g.Decrypt(base64.StdEncoding.EncodeToString(tt.msg)); err != ErrMalformed {
+			t.Errorf("%s: Decrypt error = %v, want %v", tt.name, err, ErrMalformed)
+		}
+	}
+}
+
+func TestCBCMessageRejectedByGCM(t *testing.T) {
+	c, _ := New(testKey, PKCS7Padding)
+	g, _ := NewGCM(testKey)
+	msg, _ := c.Encrypt([]byte("#1 2 3|rocket|1.52"))
+	if _, err := g.Decrypt(msg); err == nil {
+		t.Error("GCM decrypted a CBC message")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if p, err := ParsePadding("PKCS7"); err != nil || p != PKCS7Padding {
+		t.Errorf("ParsePadding(PKCS7) = %v, %v", p, err)
+	}
+	if p, err := ParsePadding("space"); err != nil || p != SpacePadding {
+		t.Errorf("ParsePadding(space) = %v, %v", p, err)
+	}
+	if _, err := ParsePadding("zero"); err == nil {
+		t.Error("ParsePadding(zero) returned no error")
+	}
+	if m, err := ParseMode("GCM"); err != nil || m != GCMMode {
+		t.Errorf("ParseMode(GCM) = %v, %v", m, err)
+	}
+	if m, err := ParseMode("cbc"); err != nil || m != CBCMode {
+		t.Errorf("ParseMode(cbc) = %v, %v", m, err)
+	}
+	if _, err := ParseMode("ecb"); err == nil {
+		t.Error("ParseMode(ecb) returned no error")
+	}
+}
+
+func TestNewCipher(t *testing.T) {
+	for _, mode := range []Mode{CBCMode, GCMMode} {
+		c, err := NewCipher(mode, testKey, PKCS7Padding)
+		if err != nil {
+			t.Fatalf("NewCipher(%v) error = %v", mode, err)
+		}
+		msg, _ := c.Encrypt([]byte("#1 2 3|rocket|1.52"))
+		if got, err := c.Decrypt(msg); err != nil || string(got) != "#1 2 3|rocket|1.52" {
+			t.Errorf("%v: Decrypt = %q, %v", mode, got, err)
+		}
+	}
+	if _, err := NewCipher(Mode(7), testKey, SpacePadding); err == nil {
+		t.Error("NewCipher with unknown mode returned no error")
+	}
+	if _, err := NewCipher(GCMMode, []byte("short"), SpacePadding); err == nil {
+		t.Error("NewCipher with bad key returned no error")
+	}
+}
@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EnvelopeV1 : Version byte of the AES-GCM envelope
+const EnvelopeV1 byte = 1
+
+// Errors returned by GCM.Decrypt
+var (
+	ErrUnsupportedVersion = errors.New("codec: unsupported envelope version")
+	ErrAuthFailed         = errors.New("codec: message authentication failed")
+)
+
+// GCM : AES-GCM codec, a corrupted or tampered message fails to decrypt instead of yielding garbage
+// Envelope is version (1 byte) | nonce (12 bytes) | ciphertext | tag (16 bytes), base64 encoded
+// The version byte is authenticated as additional data so it cannot be swapped
+type GCM struct {
+	aead cipher.AEAD
+}
+
+// NewGCM : Returns a GCM codec, key must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256
+func NewGCM(key []byte) (*GCM, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &GCM{aead: aead}, nil
+}
+
+// Encrypt : Seals plaintext in a v1 envelope with a fresh nonce from crypto/rand
+func (g *GCM) Encrypt(plaintext []byte) (string, error) {
+	nonceSize := g.aead.NonceSize()
+	envelope := make([]byte, 1+nonceSize, 1+nonceSize+len(plaintext)+g.aead.Overhead())
+	envelope[0] = EnvelopeV1
+	nonce := envelope[1 : 1+nonceSize]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("codec: generating nonce: %v", err)
+	}
+	// Seal appends ciphertext | tag to the envelope
+	envelope = g.aead.Seal(envelope, nonce, plaintext, envelope[:1])
+	return base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+// Decrypt : Opens an envelope produced by Encrypt
+func (g *GCM) Decrypt(msg string) ([]byte, error) {
+	envelope, err := base64.StdEncoding.DecodeString(strings.TrimSpace(msg))
+	if err != nil {
+		return nil, fmt.Errorf("codec: %v", err)
+	}
+	if len(envelope) == 0 {
+		return nil, ErrMalformed
+	}
+	if envelope[0] != EnvelopeV1 {
+		return nil, ErrUnsupportedVersion
+	}
+	nonceSize := g.aead.NonceSize()
+	if len(envelope) < 1+nonceSize+g.aead.Overhead() {
+		return nil, ErrMalformed
+	}
+	nonce, sealed := envelope[1:1+nonceSize], envelope[1+nonceSize:]
+	plaintext, err := g.aead.Open(nil, nonce, sealed, envelope[:1])
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,391 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config : Settings shared by all commands
+// Precedence from lowest to highest is defaults, config file, environment variables, flags
+type Config struct {
+	Broker     BrokerConfig `yaml:"broker"`
+	EvalServer string       `yaml:"evalServer"` // <ip>:<port> of eval server
+	Dashboard  string       `yaml:"dashboard"`  // http url of dashboard server
+	EvalClient string       `yaml:"evalClient"` // http url of EvalClient httpserver
+	Key        string       `yaml:"key"`        // AES key shared with eval server
+	KeyFile    string       `yaml:"keyFile"`    // file holding the AES key, takes precedence over Key when set
+	Padding    string       `yaml:"padding"`    // padding of eval server messages, space or pkcs7, cbc only
+	Cipher     string       `yaml:"cipher"`     // cipher mode of eval server messages, cbc (legacy) or gcm
+	NTP        NTPConfig    `yaml:"ntp"`
+
+	DashboardSinks []string `yaml:"dashboardSinks"` // where EvalClient delivers predictions: http, ws, sse, mqtt and/or file
+	DashboardTopic string   `yaml:"dashboardTopic"` // MQTT topic of the mqtt sink
+	DashboardFile  string   `yaml:"dashboardFile"`  // JSONL file of the file sink
+
+	DashboardOrigins []string `yaml:"dashboardOrigins"` // browser origins allowed to open the ws sink besides Dashboard, * allows any
+}
+
+// NTPConfig : Clock synchronisation settings
+type NTPConfig struct {
+	Servers []string      `yaml:"servers"` // host:port of NTP servers, the one with the lowest round trip delay is used
+	Samples int           `yaml:"samples"` // samples per server on every sync
+	Resync  time.Duration `yaml:"resync"`  // interval between background resyncs, 0 to sync once on startup only
+}
+
+// BrokerConfig : MQTT broker connection settings
+type BrokerConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	CAFile   string `yaml:"caFile"` // PEM CA certificates trusted besides the system roots, ie: for a self-signed LAN broker
+
+	StartQoS   byte `yaml:"startQoS"`   // QoS for start of move readings, losing one breaks sync delay calculation
+	DataQoS    byte `yaml:"dataQoS"`    // QoS for bulk IMU readings
+	Retain     bool `yaml:"retain"`     // Publish readings with the retain flag set
+	Persistent bool `yaml:"persistent"` // Subscribers use a persistent session to catch up after a disconnect
+}
+
+// QoS : Returns QoS to publish a reading with
+func (b BrokerConfig) QoS(isStartMove bool) byte {
+	if isStartMove {
+		return b.StartQoS
+	}
+	return b.DataQoS
+}
+
+// SubscribeQoS : Returns QoS to subscribe to readings with, the highest of StartQoS and DataQoS
+func (b BrokerConfig) SubscribeQoS() byte {
+	if b.StartQoS > b.DataQoS {
+		return b.StartQoS
+	}
+	return b.DataQoS
+}
+
+// TLSConfig : Returns TLS settings for connecting to the broker, trusting CAFile as well as the system roots
+func (b BrokerConfig) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		//Go will dig out and use the System RootCA cert set if nothing is passed in
+		ClientAuth: tls.NoClientCert, //we do not use client certs for auth
+		ClientCAs:  nil,
+	}
+	if b.CAFile == "" {
+		return tlsConfig, nil
+	}
+	pem, err := ioutil.ReadFile(b.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading broker CA file: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in broker CA file %s", b.CAFile)
+	}
+	tlsConfig.RootCAs = pool
+	return tlsConfig, nil
+}
+
+// Setting names, pass to NewLoader to register the matching flag
+const (
+	Broker       = "broker"
+	MQTTUser     = "mqttuser"
+	MQTTPassword = "mqttpass"
+	BrokerCA     = "brokerca"
+	EvalServer   = "conn"
+	Dashboard    = "dashconn"
+	EvalClient   = "evalclientconn"
+	Key          = "key"
+	StartQoS     = "startqos"
+	DataQoS      = "dataqos"
+	Retain       = "retain"
+	Persistent   = "persistent"
+	NTPServers   = "ntp"
+	NTPResync    = "ntpresync"
+	KeyFile      = "keyfile"
+	Padding      = "padding"
+	Cipher       = "cipher"
+	DashSinks    = "dashsink"
+	DashTopic    = "dashtopic"
+	DashFile     = "dashfile"
+	DashOrigins  = "dashorigin"
+)
+
+type setting struct {
+	env    string
+	usage  string
+	isBool bool
+	get    func(c *Config) string
+	set    func(c *Config, val string) error
+}
+
+func stringSetting(env string, usage string, field func(c *Config) *string) setting {
+	return setting{
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return *field(c) },
+		set: func(c *Config, val string) error {
+			*field(c) = val
+			return nil
+		},
+	}
+}
+
+func qosSetting(env string, usage string, field func(c *Config) *byte) setting {
+	return setting{
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return strconv.Itoa(int(*field(c))) },
+		set: func(c *Config, val string) error {
+			qos, err := strconv.Atoi(val)
+			if err != nil || qos < 0 || qos > 2 {
+				return fmt.Errorf("invalid QoS %q, expected 0, 1 or 2", val)
+			}
+			*field(c) = byte(qos)
+			return nil
+		},
+	}
+}
+
+func boolSetting(env string, usage string, field func(c *Config) *bool) setting {
+	return setting{
+		env:    env,
+		usage:  usage,
+		isBool: true,
+		get:    func(c *Config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *Config, val string) error {
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return fmt.Errorf("invalid bool %q", val)
+			}
+			*field(c) = b
+			return nil
+		},
+	}
+}
+
+func listSetting(env string, usage string, field func(c *Config) *[]string) setting {
+	return setting{
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return strings.Join(*field(c), ",") },
+		set: func(c *Config, val string) error {
+			var list []string
+			for _, item := range strings.Split(val, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			if len(list) == 0 {
+				return fmt.Errorf("empty list %q", val)
+			}
+			*field(c) = list
+			return nil
+		},
+	}
+}
+
+func durationSetting(env string, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{
+		env:   env,
+		usage: usage,
+		get:   func(c *Config) string { return field(c).String() },
+		set: func(c *Config, val string) error {
+			d, err := time.ParseDuration(val)
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid duration %q", val)
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+// flagValue : Raw flag value, parsed by the matching setting on Load
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(val string) error {
+	f.value = val
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+var settings = map[string]setting{
+	Broker: stringSetting("LAPIS_BROKER", "please enter url of MQTT broker, for example: -broker=ssl://mqtts.qz.sg:8883",
+		func(c *Config) *string { return &c.Broker.URL }),
+	MQTTUser: stringSetting("LAPIS_MQTT_USER", "MQTT username",
+		func(c *Config) *string { return &c.Broker.Username }),
+	MQTTPassword: stringSetting("LAPIS_MQTT_PASSWORD", "MQTT password",
+		func(c *Config) *string { return &c.Broker.Password }),
+	BrokerCA: stringSetting("LAPIS_BROKER_CA", "Optional, PEM file of CA certificates to trust for the broker besides the system roots, ie: the certificate of Broker -tlslisten",
+		func(c *Config) *string { return &c.Broker.CAFile }),
+	EvalServer: stringSetting("LAPIS_EVAL_SERVER", "please enter <ip>:<port> of eval server, for example: -conn=127.0.0.1:12345",
+		func(c *Config) *string { return &c.EvalServer }),
+	Dashboard: stringSetting("LAPIS_DASHBOARD", "please enter http://<ip>:<port>/path of dashboard server, for example: -dashconn=http://127.0.0.1:3000/api/prediction/",
+		func(c *Config) *string { return &c.Dashboard }),
+	EvalClient: stringSetting("LAPIS_EVAL_CLIENT", "please enter http://<ip>:<port> of evalclient httpserver, for example: -evalclientconn=http://127.0.0.1:10202",
+		func(c *Config) *string { return &c.EvalClient }),
+	Key: stringSetting("LAPIS_KEY", "AES key shared with eval server, must be 16, 24 or 32 bytes long",
+		func(c *Config) *string { return &c.Key }),
+	KeyFile: stringSetting("LAPIS_KEY_FILE", "Optional, file holding the AES key, takes precedence over -key",
+		func(c *Config) *string { return &c.KeyFile }),
+	Padding: stringSetting("LAPIS_PADDING", "Padding of eval server messages: space (eval_server.py) or pkcs7",
+		func(c *Config) *string { return &c.Padding }),
+	Cipher: stringSetting("LAPIS_CIPHER", "Cipher mode of eval server messages: cbc (legacy, eval_server.py) or gcm (authenticated, versioned envelope)",
+		func(c *Config) *string { return &c.Cipher }),
+	StartQoS: qosSetting("LAPIS_START_QOS", "MQTT QoS for start of move readings",
+		func(c *Config) *byte { return &c.Broker.StartQoS }),
+	DataQoS: qosSetting("LAPIS_DATA_QOS", "MQTT QoS for all other readings",
+		func(c *Config) *byte { return &c.Broker.DataQoS }),
+	Retain: boolSetting("LAPIS_RETAIN", "Publish readings with the MQTT retain flag",
+		func(c *Config) *bool { return &c.Broker.Retain }),
+	Persistent: boolSetting("LAPIS_PERSISTENT", "Use a persistent MQTT session, requires a fixed -cid",
+		func(c *Config) *bool { return &c.Broker.Persistent }),
+	NTPServers: listSetting("LAPIS_NTP_SERVERS", "Comma separated host:port of NTP servers, for example: -ntp=sg.pool.ntp.org:123,time.google.com:123",
+		func(c *Config) *[]string { return &c.NTP.Servers }),
+	NTPResync: durationSetting("LAPIS_NTP_RESYNC", "Interval between background NTP resyncs, 0 to sync once on startup only",
+		func(c *Config) *time.Duration { return &c.NTP.Resync }),
+	DashSinks: listSetting("LAPIS_DASHBOARD_SINKS", "Comma separated dashboard sinks: http (POST to -dashconn), ws, sse, mqtt and/or file, for example: -dashsink=http,file",
+		func(c *Config) *[]string { return &c.DashboardSinks }),
+	DashTopic: stringSetting("LAPIS_DASHBOARD_TOPIC", "MQTT topic the mqtt dashboard sink publishes to",
+		func(c *Config) *string { return &c.DashboardTopic }),
+	DashFile: stringSetting("LAPIS_DASHBOARD_FILE", "JSONL file the file dashboard sink appends to",
+		func(c *Config) *string { return &c.DashboardFile }),
+	DashOrigins: listSetting("LAPIS_DASHBOARD_ORIGINS", "Comma separated origins allowed to open the ws dashboard sink besides -dashconn, * allows any, for example: -dashorigin=http://192.168.1.5:3000",
+		func(c *Config) *[]string { return &c.DashboardOrigins }),
+}
+
+// Default : Returns default configuration
+func Default() Config {
+	return Config{
+		Broker: BrokerConfig{
+			URL:      "ssl://mqtts.qz.sg:8883",
+			Username: "xilinx",
+			Password: "undecimus",
+			StartQoS: 1,
+			DataQoS:  0,
+		},
+		EvalServer: "127.0.0.1:12345",
+		Dashboard:  "http://127.0.0.1:3000/api/prediction/",
+		EvalClient: "http://127.0.0.1:10202",
+		Key:        "testtesttesttest",
+		Padding:    "space",
+		Cipher:     "cbc",
+
+		DashboardSinks: []string{"http"},
+		DashboardTopic: "lapis/dashboard",
+		DashboardFile:  "dashboard.jsonl",
+		NTP: NTPConfig{
+			Servers: []string{"sg.pool.ntp.org:123", "time.google.com:123"},
+			Samples: 4,
+			Resync:  10 * time.Minute,
+		},
+	}
+}
+
+// Loader : Loads Config from file, environment variables and flags
+type Loader struct {
+	fs       *flag.FlagSet
+	defaults Config
+	path     string
+	flags    map[string]*flagValue
+}
+
+// NewLoader : Registers -config and a flag for each named setting on fs
+// Call Load once fs has been parsed
+func NewLoader(fs *flag.FlagSet, defaults Config, names ...string) *Loader {
+	l := &Loader{
+		fs:       fs,
+		defaults: defaults,
+		flags:    make(map[string]*flagValue),
+	}
+	fs.StringVar(&l.path, "config", "", "Optional, path to YAML config file, can also be set using LAPIS_CONFIG")
+	for _, name := range names {
+		s, ok := settings[name]
+		if !ok {
+			panic("config: unknown setting " + name)
+		}
+		val := &flagValue{value: s.get(&defaults), isBool: s.isBool}
+		fs.Var(val, name, s.usage+" (env "+s.env+")")
+		l.flags[name] = val
+	}
+	return l
+}
+
+// Load : Returns Config built from defaults, config file, environment variables then flags
+func (l *Loader) Load() (*Config, error) {
+	cfg := l.defaults
+
+	path := l.path
+	if path == "" {
+		path = os.Getenv("LAPIS_CONFIG")
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %v", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %v", path, err)
+		}
+	}
+
+	for _, s := range settings {
+		if val, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(&cfg, val); err != nil {
+				return nil, fmt.Errorf("%s: %v", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	l.fs.Visit(func(f *flag.Flag) {
+		if val, ok := l.flags[f.Name]; ok && err == nil {
+			if setErr := settings[f.Name].set(&cfg, val.value); setErr != nil {
+				err = fmt.Errorf("-%s: %v", f.Name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Broker.StartQoS > 2 || cfg.Broker.DataQoS > 2 {
+		return nil, fmt.Errorf("QoS must be 0, 1 or 2")
+	}
+
+	if len(cfg.NTP.Servers) == 0 {
+		return nil, fmt.Errorf("at least one NTP server is required")
+	}
+	if cfg.NTP.Resync < 0 {
+		return nil, fmt.Errorf("NTP resync interval must not be negative")
+	}
+
+	if _, ok := l.flags[Key]; ok {
+		if cfg.KeyFile != "" {
+			data, err := ioutil.ReadFile(cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading key file: %v", err)
+			}
+			cfg.Key = strings.TrimRight(string(data), "\r\n")
+		}
+		if n := len(cfg.Key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("key must be 16, 24 or 32 bytes long, got %d", n)
+		}
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,236 @@
+package dashboard
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// Update : Prediction of a single round as delivered to every sink
+type Update struct {
+	Seq      uint64  `json:"seq"`  // assigned by Dispatcher, increases by one per update so sinks can spot gaps
+	Data     string  `json:"data"` // #pos|move|delay|dancer moves
+	Round    int     `json:"round,omitempty"`
+	Strategy string  `json:"strategy,omitempty"`
+	Score    float64 `json:"score,omitempty"`
+	Tied     bool    `json:"tied,omitempty"`
+	Ts       int64   `json:"ts"` // unix nanoseconds
+}
+
+// Sink : Destination for dashboard updates
+// Send is only ever called from a single goroutine, an error makes the update retry with backoff
+type Sink interface {
+	Send(u Update) error
+	Close() error
+}
+
+// Kind : Type of sink selected by configuration
+type Kind string
+
+// Sink kinds
+const (
+	HTTPKind      Kind = "http" // POST to the dashboard url
+	WebSocketKind Kind = "ws"   // push to websocket clients of EvalClient
+	SSEKind       Kind = "sse"  // push to server-sent events clients of EvalClient
+	MQTTKind      Kind = "mqtt" // publish to an MQTT topic
+	FileKind      Kind = "file" // append to a JSONL file
+)
+
+// ParseKind : Returns Kind named s
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(strings.ToLower(s)); k {
+	case HTTPKind, WebSocketKind, SSEKind, MQTTKind, FileKind:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown dashboard sink %q, expected http, ws, sse, mqtt or file", s)
+}
+
+// Status : Delivery state of a single sink
+type Status struct {
+	Sink      string `json:"sink"`
+	Queued    int    `json:"queued"`  // updates waiting to be delivered
+	Sent      int    `json:"sent"`    // updates delivered
+	Dropped   int    `json:"dropped"` // updates dropped because the queue was full
+	Failures  int    `json:"failures"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// queue : Bounded retry queue in front of a sink, updates are delivered in order and the oldest is dropped once full
+type queue struct {
+	name     string
+	sink     Sink
+	capacity int
+
+	mu      sync.Mutex
+	pending []Update
+	status  Status
+
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (q *queue) push(u Update) {
+	q.mu.Lock()
+	if len(q.pending) >= q.capacity {
+		q.pending = q.pending[1:]
+		q.status.Dropped++
+		log.Warn("Dashboard sink ", q.name, " queue full, dropped oldest update, ", q.status.Dropped, " dropped so far")
+	}
+	q.pending = append(q.pending, u)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) head() (Update, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return Update{}, false
+	}
+	return q.pending[0], true
+}
+
+func (q *queue) run() {
+	defer close(q.stopped)
+	backoff := minBackoff
+	for {
+		u, ok := q.head()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.done:
+				return
+			}
+		}
+
+		if err := q.sink.Send(u); err != nil {
+			q.mu.Lock()
+			q.status.Failures++
+			q.status.LastError = err.Error()
+			q.mu.Unlock()
+			log.Warn("Dashboard sink ", q.name, " failed, retrying round ", u.Round, " in ", backoff, " | ", err)
+			select {
+			case <-time.After(backoff):
+			case <-q.done:
+				return
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+
+		q.mu.Lock()
+		if len(q.pending) > 0 && q.pending[0].Seq == u.Seq { // may have been dropped while sending
+			q.pending = q.pending[1:]
+		}
+		q.status.Sent++
+		q.mu.Unlock()
+	}
+}
+
+func (q *queue) state() Status {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := q.status
+	s.Queued = len(q.pending)
+	return s
+}
+
+// Dispatcher : Delivers every update to all sinks, each sink has its own retry queue so a failing sink does not hold up the rest
+type Dispatcher struct {
+	mu     sync.Mutex
+	seq    uint64
+	queues []*queue
+}
+
+// NewDispatcher : Returns a Dispatcher without sinks, call Add for each sink
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Add : Starts delivering to sink, queueing at most capacity updates while it is failing
+func (d *Dispatcher) Add(name string, sink Sink, capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &queue{
+		name:     name,
+		sink:     sink,
+		capacity: capacity,
+		status:   Status{Sink: name},
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	d.mu.Lock()
+	d.queues = append(d.queues, q)
+	d.mu.Unlock()
+	go q.run()
+}
+
+// Publish : Queues u for every sink without blocking, Seq and a missing Ts are filled in
+// Returns u as queued
+func (d *Dispatcher) Publish(u Update) Update {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	u.Seq = d.seq
+	if u.Ts == 0 {
+		u.Ts = time.Now().UnixNano()
+	}
+	for _, q := range d.queues {
+		q.push(u)
+	}
+	return u
+}
+
+// Status : Returns delivery state of every sink in the order they were added
+func (d *Dispatcher) Status() []Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := make([]Status, len(d.queues))
+	for i, q := range d.queues {
+		status[i] = q.state()
+	}
+	return status
+}
+
+// Stop : Waits up to flush for queued updates to be delivered, then stops retrying and closes every sink
+func (d *Dispatcher) Stop(flush time.Duration) {
+	d.mu.Lock()
+	queues := d.queues
+	d.queues = nil
+	d.mu.Unlock()
+
+	deadline := time.Now().Add(flush)
+	for _, q := range queues {
+		for q.state().Queued > 0 && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		close(q.done)
+		<-q.stopped
+		if n := q.state().Queued; n > 0 {
+			log.Warn("Dashboard sink ", q.name, " stopped with ", n, " undelivered updates")
+		}
+		if err := q.sink.Close(); err != nil {
+			log.Warn("Closing dashboard sink ", q.name, " | ", err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	subscriberBuffer = 64
+	keepAlive        = 15 * time.Second
+)
+
+// Hub : Pushes updates to dashboards connected over websocket or server-sent events
+// The last history updates are kept so a client reconnecting with the last seq it saw receives what it missed,
+// ie: Last-Event-ID for server-sent events or ?since=<seq> for both
+// A client that falls behind by more than subscriberBuffer updates is disconnected and has to reconnect to catch up
+type Hub struct {
+	mu      sync.Mutex
+	history []Update
+	size    int
+	subs    map[chan Update]bool
+	closed  bool
+}
+
+// NewHub : Returns a Hub remembering the last history updates
+func NewHub(history int) *Hub {
+	return &Hub{size: history, subs: make(map[chan Update]bool)}
+}
+
+// Send : Pushes u to every connected client, never fails so updates are never retried
+func (h *Hub) Send(u Update) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = append(h.history, u)
+	if len(h.history) > h.size {
+		h.history = h.history[len(h.history)-h.size:]
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- u:
+		default:
+			log.Warn("Dashboard client fell behind, disconnecting it so it resumes from its last update")
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// Close : Disconnects every client
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+	return nil
+}
+
+// subscribe : Returns updates after since to replay and a channel of new updates, closed when the client must go
+// A since newer than the latest update means EvalClient restarted, the whole history is replayed
+func (h *Hub) subscribe(since uint64, resume bool) ([]Update, chan Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan Update, subscriberBuffer)
+	if h.closed {
+		close(ch)
+		return nil, ch
+	}
+	h.subs[ch] = true
+
+	if !resume {
+		return nil, ch
+	}
+	if n := len(h.history); n > 0 && since > h.history[n-1].Seq {
+		since = 0
+	}
+	var backlog []Update
+	for _, u := range h.history {
+		if u.Seq > since {
+			backlog = append(backlog, u)
+		}
+	}
+	return backlog, ch
+}
+
+func (h *Hub) unsubscribe(ch chan Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[ch] {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// resumeFrom : Returns the last seq the client saw from Last-Event-ID or ?since=
+func resumeFrom(req *http.Request) (uint64, bool) {
+	val := req.Header.Get("Last-Event-ID")
+	if val == "" {
+		val = req.URL.Query().Get("since")
+	}
+	if val == "" {
+		return 0, false
+	}
+	since, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return since, true
+}
+
+// ServeSSE : Streams updates as server-sent events, the event id is the update seq
+func (h *Hub) ServeSSE(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	since, resume := resumeFrom(req)
+	backlog, ch := h.subscribe(since, resume)
+	defer h.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	log.Info("Dashboard SSE client connected | ", req.RemoteAddr, " | replaying ", len(backlog))
+
+	write := func(u Update) error {
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", u.Seq, data)
+		flusher.Flush()
+		return err
+	}
+	for _, u := range backlog {
+		if write(u) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case u, ok := <-ch:
+			if !ok || write(u) != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			log.Info("Dashboard SSE client disconnected | ", req.RemoteAddr)
+			return
+		}
+	}
+}
+
+// WebSocketHandler : Returns a handler pushing every update as a json text message
+// Browsers may only connect from the same host or one of origins ie: http://127.0.0.1:3000, "*" accepts any origin
+// Clients which send no Origin, ie: anything but a browser, are always accepted
+func (h *Hub) WebSocketHandler(origins []string) http.Handler {
+	return websocket.Server{
+		Handshake: func(_ *websocket.Config, req *http.Request) error { return checkOrigin(req, origins) },
+		Handler:   h.serveWS,
+	}
+}
+
+// checkOrigin : Rejects a browser connecting from another site, which would otherwise read every update
+func checkOrigin(req *http.Request, origins []string) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return nil
+	}
+	for _, allowed := range origins {
+		if allowed == "*" {
+			return nil
+		}
+		if a, err := url.Parse(allowed); err == nil && strings.EqualFold(a.Scheme, u.Scheme) && strings.EqualFold(a.Host, u.Host) {
+			return nil
+		}
+	}
+	log.Warn("Dashboard websocket client rejected | origin ", origin, " not allowed")
+	return fmt.Errorf("origin %q not allowed", origin)
+}
+
+func (h *Hub) serveWS(ws *websocket.Conn) {
+	defer ws.Close()
+	since, resume := resumeFrom(ws.Request())
+	backlog, ch := h.subscribe(since, resume)
+	defer h.unsubscribe(ch)
+	log.Info("Dashboard websocket client connected | ", ws.Request().RemoteAddr, " | replaying ", len(backlog))
+
+	// Messages from the client are ignored, reading only detects the disconnect
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(gone)
+	}()
+
+	for _, u := range backlog {
+		if websocket.JSON.Send(ws, u) != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case u, ok := <-ch:
+			if !ok || websocket.JSON.Send(ws, u) != nil {
+				return
+			}
+		case <-gone:
+			log.Info("Dashboard websocket client disconnected | ", ws.Request().RemoteAddr)
+			return
+		}
+	}
+}
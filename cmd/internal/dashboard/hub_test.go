@@ -0,0 +1,34 @@
+package dashboard
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+var originTests = []struct {
+	origin  string
+	origins []string
+	ok      bool
+}{
+	{"", nil, true}, // not a browser
+	{"http://127.0.0.1:10202", nil, true},
+	{"http://evil.example", nil, false},
+	{"http://127.0.0.1:3000", []string{"http://127.0.0.1:3000/api/prediction/"}, true},
+	{"https://127.0.0.1:3000", []string{"http://127.0.0.1:3000/api/prediction/"}, false},
+	{"http://127.0.0.1:3001", []string{"http://127.0.0.1:3000/api/prediction/"}, false},
+	{"http://192.168.1.5:3000", []string{"http://127.0.0.1:3000/", "http://192.168.1.5:3000"}, true},
+	{"http://evil.example", []string{"http://127.0.0.1:3000/", "*"}, true},
+	{"::", []string{"*"}, false},
+}
+
+func TestCheckOrigin(t *testing.T) {
+	for _, tt := range originTests {
+		req := httptest.NewRequest("GET", "http://127.0.0.1:10202/dashboard/ws", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if err := checkOrigin(req, tt.origins); (err == nil) != tt.ok {
+			t.Errorf("checkOrigin(%q, %q) = %v, want ok %v", tt.origin, tt.origins, err, tt.ok)
+		}
+	}
+}
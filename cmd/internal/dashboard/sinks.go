@@ -0,0 +1,147 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	postTimeout    = 5 * time.Second
+	publishTimeout = 5 * time.Second
+)
+
+// HTTPSink : POSTs every update as json to the dashboard, any non 2xx reply is retried
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink : Returns an HTTPSink posting to url
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: postTimeout}}
+}
+
+// Send : Posts u
+func (s *HTTPSink) Send(u Update) error {
+	body, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("dashboard replied %s | %s", resp.Status, respBody)
+	}
+	log.Debug("Dashboard replied | ", string(respBody))
+	return nil
+}
+
+// Close : Nothing to release
+func (s *HTTPSink) Close() error {
+	return nil
+}
+
+// FileSink : Appends every update to a file as one json object per line (JSONL)
+type FileSink struct {
+	f *os.File
+}
+
+// NewFileSink : Opens path for appending, creating it if needed
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Send : Appends u as a single line
+func (s *FileSink) Send(u Update) error {
+	line, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+// Close : Closes the file
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
+
+var errNotConnected = errors.New("not connected to MQTT Broker")
+
+// MQTTSink : Publishes every update as json to an MQTT topic with QoS 1
+// Connects in the background and reconnects automatically, updates are retried until the broker acknowledges them
+type MQTTSink struct {
+	client mqtt.Client
+	topic  string
+	done   chan struct{}
+}
+
+// NewMQTTSink : Returns an MQTTSink publishing to topic and starts connecting with opts
+func NewMQTTSink(opts *mqtt.ClientOptions, topic string) *MQTTSink {
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(maxBackoff)
+	s := &MQTTSink{client: mqtt.NewClient(opts), topic: topic, done: make(chan struct{})}
+	go s.connect()
+	return s
+}
+
+func (s *MQTTSink) connect() {
+	backoff := minBackoff
+	for {
+		token := s.client.Connect()
+		if token.Wait() && token.Error() == nil {
+			log.Info("Dashboard sink connected to MQTT Broker, publishing to ", s.topic)
+			return
+		}
+		log.Warn("Dashboard sink could not connect to MQTT Broker, retrying in ", backoff, " | ", token.Error())
+		select {
+		case <-time.After(backoff):
+		case <-s.done:
+			return
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Send : Publishes u and waits for the broker to acknowledge it
+func (s *MQTTSink) Send(u Update) error {
+	if !s.client.IsConnectionOpen() {
+		return errNotConnected
+	}
+	payload, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	token := s.client.Publish(s.topic, 1, false, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("publish not acknowledged within %v", publishTimeout)
+	}
+	return token.Error()
+}
+
+// Close : Stops connecting and disconnects from the broker
+func (s *MQTTSink) Close() error {
+	close(s.done)
+	s.client.Disconnect(250)
+	return nil
+}
@@ -0,0 +1,209 @@
+package evalapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Endpoints of the v2 API served by EvalClient
+const (
+	MovePath      = "/v2/move"
+	DelayPath     = "/v2/delay"
+	PositionsPath = "/v2/positions"
+)
+
+const maxBodySize = 64 << 10
+
+// Move : Move predicted for a single dancer
+type Move struct {
+	MoveID     int      `json:"moveId,omitempty"` // round the move belongs to, 0 joins the oldest round the dancer has not voted in
+	ClientID   string   `json:"clientId"`         // 1 to N
+	Move       string   `json:"move"`
+	Confidence *float64 `json:"confidence,omitempty"` // 0 to 1, treated as 1 if not reported
+	Ts         int64    `json:"ts,omitempty"`         // unix nanoseconds
+}
+
+// GetConfidence : Returns reported confidence, 1 if not reported
+func (m Move) GetConfidence() float64 {
+	if m.Confidence == nil {
+		return 1
+	}
+	return *m.Confidence
+}
+
+// Delay : Sync delay of a move
+type Delay struct {
+	Delay  float64  `json:"delay"`            // milliseconds between fastest and slowest dancer
+	Absent []string `json:"absent,omitempty"` // clientIDs whose start packet never arrived
+	Ts     int64    `json:"ts,omitempty"`
+}
+
+// Positions : Position changes of a move, DancerNos[i] moved by Changes[i]
+type Positions struct {
+	DancerNos []int    `json:"dancerNos"`
+	Changes   []int    `json:"changes"`
+	ClientIDs []string `json:"clientIds,omitempty"` // same length as DancerNos if present
+	Ts        int64    `json:"ts,omitempty"`
+}
+
+// Validator : Request body which can be checked against a group of dancers
+type Validator interface {
+	Validate(dancers int) error
+}
+
+// Validate : Checks m is a move for one of dancers
+func (m Move) Validate(dancers int) error {
+	if err := validateClientID(m.ClientID, dancers); err != nil {
+		return fmt.Errorf("clientId: %v", err)
+	}
+	if strings.TrimSpace(m.Move) == "" {
+		return fmt.Errorf("move: must not be empty")
+	}
+	if m.MoveID < 0 {
+		return fmt.Errorf("moveId: must not be negative, got %d", m.MoveID)
+	}
+	if c := m.Confidence; c != nil && (math.IsNaN(*c) || *c < 0 || *c > 1) {
+		return fmt.Errorf("confidence: must be between 0 and 1, got %v", *c)
+	}
+	return nil
+}
+
+// Validate : Checks d is a finite, non negative delay and every absent clientID is one of dancers
+func (d Delay) Validate(dancers int) error {
+	if math.IsNaN(d.Delay) || math.IsInf(d.Delay, 0) || d.Delay < 0 {
+		return fmt.Errorf("delay: must be a non negative number of milliseconds, got %v", d.Delay)
+	}
+	if len(d.Absent) >= dancers {
+		return fmt.Errorf("absent: at least one dancer must be present, got %d absent", len(d.Absent))
+	}
+	for i, cid := range d.Absent {
+		if err := validateClientID(cid, dancers); err != nil {
+			return fmt.Errorf("absent[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate : Checks p holds one change per dancer in range, for at most dancers distinct dancers
+func (p Positions) Validate(dancers int) error {
+	if len(p.DancerNos) == 0 {
+		return fmt.Errorf("dancerNos: must not be empty")
+	}
+	if len(p.DancerNos) > dancers {
+		return fmt.Errorf("dancerNos: got %d dancers, expected at most %d", len(p.DancerNos), dancers)
+	}
+	if len(p.Changes) != len(p.DancerNos) {
+		return fmt.Errorf("changes: got %d changes for %d dancerNos", len(p.Changes), len(p.DancerNos))
+	}
+	if len(p.ClientIDs) != 0 && len(p.ClientIDs) != len(p.DancerNos) {
+		return fmt.Errorf("clientIds: got %d clientIds for %d dancerNos", len(p.ClientIDs), len(p.DancerNos))
+	}
+	seen := make(map[int]bool)
+	for i, dNo := range p.DancerNos {
+		if dNo < 1 || dNo > dancers {
+			return fmt.Errorf("dancerNos[%d]: %d is not between 1 and %d", i, dNo, dancers)
+		}
+		if seen[dNo] {
+			return fmt.Errorf("dancerNos[%d]: duplicate dancer %d", i, dNo)
+		}
+		seen[dNo] = true
+		if c := p.Changes[i]; c <= -dancers || c >= dancers {
+			return fmt.Errorf("changes[%d]: %d is out of range for %d dancers", i, c, dancers)
+		}
+	}
+	for i, cid := range p.ClientIDs {
+		if err := validateClientID(cid, dancers); err != nil {
+			return fmt.Errorf("clientIds[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// validateClientID : Checks cid is one of 1 to dancers in canonical form, "01", "+1" or " 1" would otherwise vote as a separate dancer
+func validateClientID(cid string, dancers int) error {
+	n, err := strconv.Atoi(cid)
+	if err != nil || n < 1 || n > dancers {
+		return fmt.Errorf("%q is not between 1 and %d", cid, dancers)
+	}
+	if strconv.Itoa(n) != cid {
+		return fmt.Errorf("%q must be written as %q", cid, strconv.Itoa(n))
+	}
+	return nil
+}
+
+// Error : Request error returned to the caller as json with Status
+type Error struct {
+	Status  int    `json:"-"`
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// legacy : Legacy request body which converts into its v2 counterpart
+type legacy interface {
+	toV2() (Validator, error)
+}
+
+// Decode : Decodes a POSTed json body into v then validates it, unknown fields are rejected when strict
+// v is a pointer to a v2 body or a legacy body, legacy bodies are converted first and the v2 body is returned ie: Move for *LegacyMove
+func Decode(w http.ResponseWriter, req *http.Request, v interface{}, dancers int, strict bool) (Validator, *Error) {
+	if req.Method != http.MethodPost {
+		return nil, &Error{Status: http.StatusMethodNotAllowed, Message: "method " + req.Method + " not allowed, use POST"}
+	}
+	if ct := req.Header.Get("Content-Type"); strict && ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/json" {
+			return nil, &Error{Status: http.StatusUnsupportedMediaType, Message: "content type must be application/json"}
+		}
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return nil, badRequest("invalid json: %v", err)
+	}
+	if dec.More() {
+		return nil, badRequest("invalid json: unexpected data after object")
+	}
+	var body Validator
+	switch v := v.(type) {
+	case legacy:
+		var err error
+		if body, err = v.toV2(); err != nil {
+			return nil, badRequest("%v", err)
+		}
+	case Validator:
+		body = v
+	default:
+		panic(fmt.Sprintf("evalapi: cannot decode into %T", v))
+	}
+	if err := body.Validate(dancers); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return body, nil
+}
+
+// WriteError : Writes err as json
+func WriteError(w http.ResponseWriter, err *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(err)
+}
+
+// WriteOK : Writes a json acknowledgement
+func WriteOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	io.WriteString(w, `{"status":"ok"}`+"\n")
+}
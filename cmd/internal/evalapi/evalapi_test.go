@@ -0,0 +1,28 @@
+package evalapi
+
+import "testing"
+
+var clientIDTests = []struct {
+	cid string
+	ok  bool
+}{
+	{"1", true},
+	{"3", true},
+	{"0", false},
+	{"4", false},
+	{"-1", false},
+	{"01", false},
+	{"+1", false},
+	{" 1", false},
+	{"1 ", false},
+	{"one", false},
+	{"", false},
+}
+
+func TestValidateClientID(t *testing.T) {
+	for _, tt := range clientIDTests {
+		if err := validateClientID(tt.cid, 3); (err == nil) != tt.ok {
+			t.Errorf("validateClientID(%q, 3) = %v, want ok %v", tt.cid, err, tt.ok)
+		}
+	}
+}
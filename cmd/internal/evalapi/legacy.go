@@ -0,0 +1,96 @@
+package evalapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Legacy request bodies, every value is a string and lists are space separated ie: "1 2 3"
+// Decode converts each into its v2 counterpart so legacy endpoints share validation and handling with /v2
+// ts is unix nanoseconds as a string, it is never a reason to reject a legacy body
+
+// LegacyMove : Body of /move ie: {"move":"rocket","cid":"1","moveId":"4","confidence":"0.9","ts":"1600000000000000000"}, moveId and confidence are optional
+type LegacyMove struct {
+	Move       string
+	Ts         string
+	Cid        string
+	MoveID     string
+	Confidence string
+}
+
+// LegacyDelay : Body of /delay ie: {"delay":"12.5","absent":"2 3","ts":"1600000000000000000"}
+type LegacyDelay struct {
+	Delay  string
+	Absent string
+	Ts     string
+}
+
+// LegacyPositions : Body of /positions ie: {"dancerNo":"1 2 3","changes":"-1 0 1","cids":"1 2 3","ts":"1600000000000000000"}
+type LegacyPositions struct {
+	DancerNo string
+	Changes  string
+	Cids     string
+	Ts       string
+}
+
+func (l LegacyMove) toV2() (Validator, error) {
+	moveID := 0
+	if strings.TrimSpace(l.MoveID) != "" {
+		var err error
+		if moveID, err = strconv.Atoi(strings.TrimSpace(l.MoveID)); err != nil {
+			return nil, fmt.Errorf("moveId: %q is not an integer", l.MoveID)
+		}
+	}
+	m := Move{MoveID: moveID, ClientID: l.Cid, Move: l.Move, Ts: tsOrNow(l.Ts)}
+	if strings.TrimSpace(l.Confidence) != "" {
+		confidence, err := strconv.ParseFloat(strings.TrimSpace(l.Confidence), 64)
+		if err != nil {
+			return nil, fmt.Errorf("confidence: %q is not a number", l.Confidence)
+		}
+		m.Confidence = &confidence
+	}
+	return m, nil
+}
+
+func (l LegacyDelay) toV2() (Validator, error) {
+	delay, err := strconv.ParseFloat(strings.TrimSpace(l.Delay), 64)
+	if err != nil {
+		return nil, fmt.Errorf("delay: %q is not a number", l.Delay)
+	}
+	return Delay{Delay: delay, Absent: strings.Fields(l.Absent), Ts: tsOrNow(l.Ts)}, nil
+}
+
+func (l LegacyPositions) toV2() (Validator, error) {
+	dancerNos, err := parseInts("dancerNo", l.DancerNo)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := parseInts("changes", l.Changes)
+	if err != nil {
+		return nil, err
+	}
+	return Positions{DancerNos: dancerNos, Changes: changes, ClientIDs: strings.Fields(l.Cids), Ts: tsOrNow(l.Ts)}, nil
+}
+
+// tsOrNow : Parses ts as unix nanoseconds, the current time if it is empty or not a positive integer
+func tsOrNow(ts string) int64 {
+	if n, err := strconv.ParseInt(strings.TrimSpace(ts), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return time.Now().UnixNano()
+}
+
+func parseInts(field string, s string) ([]int, error) {
+	fields := strings.Fields(s)
+	ints := make([]int, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not an integer", field, f)
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
@@ -0,0 +1,268 @@
+package evalconn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	minBackoff   = 500 * time.Millisecond
+	maxBackoff   = 30 * time.Second
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 5 * time.Second
+	replyTimeout = 2 * time.Second
+)
+
+// Status : Health of the eval server connection
+type Status struct {
+	Connected  bool      `json:"connected"`
+	Since      time.Time `json:"since"` // time of the last connect or disconnect
+	Reconnects int       `json:"reconnects"`
+	LastError  string    `json:"lastError,omitempty"`
+	Queued     int       `json:"queued"` // messages waiting to be sent
+	Sent       int       `json:"sent"`
+	Received   int       `json:"received"`
+}
+
+// Client : TCP client for the eval server which reconnects with exponential backoff
+// Messages are read from out only while connected so they queue up in out during an outage,
+// a message whose write failed is resent first after reconnecting
+// Messages carry no delimiter, so after each write the next one waits for the reply (or replyTimeout)
+// to keep queued messages from reaching the server in a single read
+// Replies are the positions of dancers dancers ie: "2 1 3", with or without trailing padding, and carry no delimiter either
+// They are parsed as a stream of dancer numbers, every dancers numbers make one reply so two replies arriving
+// in a single read are split again and a reply split over two reads is joined
+type Client struct {
+	addr    string
+	dancers int
+	out     chan []byte
+	replies chan<- string
+
+	mu      sync.Mutex
+	status  Status
+	pending []byte // message taken from out but not yet written
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New : Returns a Client for addr, call Start to connect
+// Pass a buffered out channel, its capacity is the number of messages queued while disconnected
+// dancers must be at most 9 as dancer numbers are single digits, replies joined without padding are split per digit
+func New(addr string, dancers int, out chan []byte, replies chan<- string) *Client {
+	return &Client{
+		addr:    addr,
+		dancers: dancers,
+		out:     out,
+		replies: replies,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start : Connects in the background, retrying until Stop is called
+func (c *Client) Start() {
+	go c.run()
+}
+
+// Stop : Closes the connection and stops reconnecting
+func (c *Client) Stop() {
+	c.stopOnce.Do(func() { close(c.done) })
+}
+
+// Status : Returns current connection health
+func (c *Client) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.status
+	s.Queued = len(c.out)
+	if c.pending != nil {
+		s.Queued++
+	}
+	return s
+}
+
+// Queue : Queues msg without blocking, drops the oldest queued message if out is full
+func (c *Client) Queue(msg []byte) {
+	for {
+		select {
+		case c.out <- msg:
+			return
+		default:
+		}
+		select {
+		case <-c.out:
+			log.Warn("Eval server queue full, dropped oldest message")
+		default:
+		}
+	}
+}
+
+func (c *Client) run() {
+	backoff := minBackoff
+	for {
+		conn, err := net.DialTimeout("tcp", c.addr, dialTimeout)
+		if err != nil {
+			c.setError(err)
+			log.Warn("Could not connect to eval server, retrying in ", backoff, " | ", err)
+			select {
+			case <-time.After(backoff):
+			case <-c.done:
+				return
+			}
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = minBackoff
+		c.setConnected(true)
+		log.Info("Lapis Comms Client connected to ", c.addr)
+
+		err = c.serve(conn)
+		c.setConnected(false)
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+		c.setError(err)
+		log.Warn("Lost connection to eval server, ", c.Status().Queued, " messages queued | ", err)
+	}
+}
+
+// serve : Writes queued messages and reads replies until the connection breaks or Stop is called
+func (c *Client) serve(conn net.Conn) error {
+	defer conn.Close()
+	readErr := make(chan error, 1)
+	ack := make(chan struct{}, 1)
+	go c.recv(conn, readErr, ack)
+
+	for {
+		msg := c.takePending()
+		if msg == nil {
+			select {
+			case m, ok := <-c.out:
+				if !ok {
+					return io.EOF
+				}
+				msg = m
+				c.setPending(msg)
+			case err := <-readErr:
+				return err
+			case <-c.done:
+				return nil
+			}
+		}
+		select {
+		case <-ack: // drop stale ack of a reply that arrived after its timeout
+		default:
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := conn.Write(msg); err != nil {
+			return err // msg stays pending and is resent after reconnecting
+		}
+		c.mu.Lock()
+		c.pending = nil
+		c.status.Sent++
+		c.mu.Unlock()
+
+		select {
+		case <-ack:
+		case <-time.After(replyTimeout):
+			log.Warn("No reply from eval server within ", replyTimeout)
+		case err := <-readErr:
+			return err
+		case <-c.done:
+			return nil
+		}
+	}
+}
+
+// recv : Reads replies, a partial reply waits up to replyTimeout for the rest and is dropped if it does not arrive
+// so a short or malformed reply does not shift every reply after it
+func (c *Client) recv(conn net.Conn, readErr chan<- error, ack chan<- struct{}) {
+	buf := make([]byte, 256)
+	var partial []string // dancer numbers of a reply still being read
+	for {
+		if len(partial) > 0 {
+			conn.SetReadDeadline(time.Now().Add(replyTimeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Warn("Dropped incomplete reply from eval server | ", strings.Join(partial, " "))
+				partial = nil
+				continue
+			}
+			readErr <- err
+			return
+		}
+
+		for _, b := range buf[:n] {
+			if b < '0' || b > '9' {
+				continue // separators and padding
+			}
+			partial = append(partial, string(b))
+			if len(partial) < c.dancers {
+				continue
+			}
+			reply := strings.Join(partial, " ")
+			partial = nil
+			log.Debug("Eval server replied | ", reply)
+
+			c.mu.Lock()
+			c.status.Received++
+			c.mu.Unlock()
+			select {
+			case ack <- struct{}{}:
+			default:
+			}
+			select {
+			case c.replies <- reply:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) takePending() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending
+}
+
+func (c *Client) setPending(msg []byte) {
+	c.mu.Lock()
+	c.pending = msg
+	c.mu.Unlock()
+}
+
+func (c *Client) setConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if connected && !c.status.Since.IsZero() {
+		c.status.Reconnects++
+	}
+	c.status.Connected = connected
+	c.status.Since = time.Now()
+}
+
+func (c *Client) setError(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	c.status.LastError = err.Error()
+	c.mu.Unlock()
+}
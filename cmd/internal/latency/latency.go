@@ -0,0 +1,85 @@
+package latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Summary : Latency of one hop over the readings seen so far
+type Summary struct {
+	Count int64
+	Mean  time.Duration
+	Max   time.Duration
+	sum   time.Duration
+}
+
+func (s *Summary) add(d time.Duration) {
+	s.Count++
+	s.sum += d
+	s.Mean = s.sum / time.Duration(s.Count)
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+// Stats : Latency of each hop a reading takes from the device to the subscriber
+type Stats struct {
+	BLE     Summary // device sample to DataPublisher receive, includes device and NTP clock differences
+	Gateway Summary // DataPublisher receive to publish, ie: batching and buffering while the broker was unreachable
+	MQTT    Summary // publish to subscriber arrival
+}
+
+// Tracker : Collects per client latencies from the timestamps carried by readings
+type Tracker struct {
+	mu      sync.Mutex
+	clients map[string]*Stats
+}
+
+// NewTracker : Returns an empty Tracker
+func NewTracker() *Tracker {
+	return &Tracker{clients: make(map[string]*Stats)}
+}
+
+// Observe : Records the timestamps of a reading of clientID in unix nanoseconds, hops with a missing (0) timestamp are skipped
+func (t *Tracker) Observe(clientID string, sample int64, receive int64, publish int64, arrival int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.clients[clientID]
+	if !ok {
+		s = &Stats{}
+		t.clients[clientID] = s
+	}
+	if sample != 0 && receive != 0 {
+		s.BLE.add(time.Duration(receive - sample))
+	}
+	if receive != 0 && publish != 0 {
+		s.Gateway.add(time.Duration(publish - receive))
+	}
+	if publish != 0 && arrival != 0 {
+		s.MQTT.add(time.Duration(arrival - publish))
+	}
+}
+
+// Stats : Returns latencies of every client seen
+func (t *Tracker) Stats() map[string]Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make(map[string]Stats, len(t.clients))
+	for id, s := range t.clients {
+		stats[id] = *s
+	}
+	return stats
+}
+
+// Clients : Returns clientIDs seen, sorted
+func (t *Tracker) Clients() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.clients))
+	for id := range t.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,268 @@
+package position
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// posChange values
+// -2 = 2x left
+// -1 = left
+//  0 = stay
+//  1 = right
+//  2 = 2x right
+
+// Change : Position change reported by a single dancer
+type Change struct {
+	DancerNo int
+	Change   int
+	ClientID string
+}
+
+// Resolver : Conflict resolution policy, assigns every unplaced dancer to one of the free places
+// Returns a map of dancerNo to place, both slices are sorted in ascending order and have the same length
+type Resolver func(unplaced []int, free []int) map[int]int
+
+// RandomResolver : Assigns unplaced dancers to free places at random, this is the original EvalClient behaviour
+func RandomResolver(unplaced []int, free []int) map[int]int {
+	shuffled := make([]int, len(unplaced))
+	copy(shuffled, unplaced)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	assigned := make(map[int]int)
+	for i, dNo := range shuffled {
+		assigned[dNo] = free[i]
+	}
+	return assigned
+}
+
+// OrderedResolver : Assigns unplaced dancers to free places in ascending dancer number order, deterministic
+func OrderedResolver(unplaced []int, free []int) map[int]int {
+	assigned := make(map[int]int)
+	for i, dNo := range unplaced {
+		assigned[dNo] = free[i]
+	}
+	return assigned
+}
+
+// PositionTracker : Tracks the place (1 = leftmost) of every dancer across position changes
+type PositionTracker struct {
+	size            int
+	resolve         Resolver
+	dancerNoToPlace map[int]int // tracks dancerno to place
+	places          map[int]int // places[1] returns dancer number in left most pos
+}
+
+// NewPositionTracker : Returns a PositionTracker for size dancers in their initial positions (dancer n in place n)
+// If resolve is nil, RandomResolver is used
+func NewPositionTracker(size int, resolve Resolver) *PositionTracker {
+	if resolve == nil {
+		resolve = RandomResolver
+	}
+	t := &PositionTracker{
+		size:            size,
+		resolve:         resolve,
+		dancerNoToPlace: make(map[int]int),
+		places:          make(map[int]int),
+	}
+	for _, dNo := range InitialPositions(size) {
+		t.dancerNoToPlace[dNo] = dNo
+		t.places[dNo] = dNo
+	}
+	return t
+}
+
+// Size : Returns number of dancers tracked
+func (t *PositionTracker) Size() int {
+	return t.size
+}
+
+// Apply : Applies one position change per dancer and returns the resulting positions
+// Dancers that move out of range or into a place already claimed by a lower dancer number are unplaced,
+// unplaced dancers are then handed to the Resolver to fill the remaining free places
+// Dancers without a change are treated as staying in place
+func (t *PositionTracker) Apply(changes []Change) []int {
+	changeOf := make(map[int]int)
+	for _, c := range changes {
+		changeOf[c.DancerNo] = c.Change
+	}
+
+	claimed := make(map[int]int)
+	var unplaced []int
+	for dNo := 1; dNo <= t.size; dNo++ {
+		tempPos := t.dancerNoToPlace[dNo] + changeOf[dNo]
+		if tempPos < 1 || tempPos > t.size {
+			unplaced = append(unplaced, dNo)
+			continue
+		}
+		if _, ok := claimed[tempPos]; ok {
+			unplaced = append(unplaced, dNo)
+			continue
+		}
+		claimed[tempPos] = dNo
+	}
+
+	if len(unplaced) > 0 {
+		var free []int
+		for place := 1; place <= t.size; place++ {
+			if _, ok := claimed[place]; !ok {
+				free = append(free, place)
+			}
+		}
+		for dNo, place := range t.resolve(unplaced, free) {
+			claimed[place] = dNo
+		}
+	}
+
+	t.setPlaces(claimed)
+	return t.Positions()
+}
+
+// Reset : Overwrites tracked positions, positions[i] is the dancer number in place i+1
+// Used to apply the correct positions returned by the eval server
+func (t *PositionTracker) Reset(positions []int) error {
+	if len(positions) != t.size {
+		return fmt.Errorf("expected %d positions, got %d", t.size, len(positions))
+	}
+	seen := make(map[int]bool)
+	placeOf := make(map[int]int)
+	for i, dNo := range positions {
+		if dNo < 1 || dNo > t.size || seen[dNo] {
+			return fmt.Errorf("invalid positions %v", positions)
+		}
+		seen[dNo] = true
+		placeOf[i+1] = dNo
+	}
+	t.setPlaces(placeOf)
+	return nil
+}
+
+// Shuffle : Assigns every dancer to a random place
+func (t *PositionTracker) Shuffle() []int {
+	random := InitialPositions(t.size)
+	rand.Shuffle(len(random), func(i, j int) { random[i], random[j] = random[j], random[i] })
+	t.Reset(random)
+	return t.Positions()
+}
+
+// Place : Returns current place of dancerNo, 0 if unknown
+func (t *PositionTracker) Place(dancerNo int) int {
+	return t.dancerNoToPlace[dancerNo]
+}
+
+// Positions : Returns dancer numbers ordered from leftmost to rightmost place
+func (t *PositionTracker) Positions() []int {
+	positions := make([]int, t.size)
+	for i := range positions {
+		positions[i] = t.places[i+1]
+	}
+	return positions
+}
+
+// String : Returns positions in eval server format ie: 1 2 3
+func (t *PositionTracker) String() string {
+	return FormatPositions(t.Positions())
+}
+
+func (t *PositionTracker) setPlaces(placeToDancer map[int]int) {
+	t.places = make(map[int]int)
+	t.dancerNoToPlace = make(map[int]int)
+	for place, dNo := range placeToDancer {
+		t.places[place] = dNo
+		t.dancerNoToPlace[dNo] = place
+	}
+}
+
+// FormatPositions : Formats positions as space separated dancer numbers ie: 1 2 3
+func FormatPositions(positions []int) string {
+	strs := make([]string, len(positions))
+	for i, p := range positions {
+		strs[i] = fmt.Sprint(p)
+	}
+	return strings.Join(strs, " ")
+}
+
+// ParsePositions : Parses space separated dancer numbers ie: 1 2 3
+func ParsePositions(s string) ([]int, error) {
+	fields := strings.Fields(s)
+	positions := make([]int, len(fields))
+	for i, f := range fields {
+		if _, err := fmt.Sscan(f, &positions[i]); err != nil {
+			return nil, fmt.Errorf("invalid position %q: %v", f, err)
+		}
+	}
+	return positions, nil
+}
+
+// Policy : How position changes whose sum is non zero are handled
+type Policy string
+
+const (
+	// StrictPolicy : Inconsistent changes are discarded and positions are randomised
+	StrictPolicy Policy = "strict"
+	// IgnorePolicy : Changes are applied as is, relying on the Resolver to settle conflicts
+	IgnorePolicy Policy = "ignore"
+	// RepairPolicy : Attempts to repair inconsistent changes before applying them
+	RepairPolicy Policy = "repair"
+)
+
+// ParsePolicy : Returns Policy named by s
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case StrictPolicy, IgnorePolicy, RepairPolicy:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q, expected strict, ignore or repair", s)
+}
+
+// SumChanges : Returns sum of all changes, the sum is always 0 for a valid formation change
+func SumChanges(changes []Change) int {
+	sum := 0
+	for _, c := range changes {
+		sum += c.Change
+	}
+	return sum
+}
+
+// Repair : Best effort repair of inconsistent changes
+// If a single dancer's change accounts for the whole non zero sum, that dancer is assumed to have stayed in place
+// Returns repaired changes and true if changes are now consistent
+func Repair(changes []Change) ([]Change, bool) {
+	sum := SumChanges(changes)
+	if sum == 0 {
+		return changes, true
+	}
+	for i, c := range changes {
+		if c.Change == sum {
+			repaired := make([]Change, len(changes))
+			copy(repaired, changes)
+			repaired[i].Change = 0
+			return repaired, true
+		}
+	}
+	return changes, false
+}
+
+// Supported group sizes
+const (
+	MinDancers = 2
+	MaxDancers = 8
+)
+
+// ValidateDancers : Returns an error if n is not a supported group size
+func ValidateDancers(n int) error {
+	if n < MinDancers || n > MaxDancers {
+		return fmt.Errorf("dancers must be between %d and %d, got %d", MinDancers, MaxDancers, n)
+	}
+	return nil
+}
+
+// InitialPositions : Returns initial positions for n dancers ie: 1 2 3
+func InitialPositions(n int) []int {
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = i + 1
+	}
+	return positions
+}
@@ -0,0 +1,369 @@
+package position
+
+import (
+	"reflect"
+	"testing"
+)
+
+// applyTests : Every -2..+2 posChange combination of 3 dancers starting from 1 2 3, resolved with OrderedResolver
+// Dancers moving out of range or into a place claimed by a lower dancer number fill the free places in ascending order
+var applyTests = []struct {
+	changes [3]int // change of dancer 1, 2 and 3
+	want    string
+}{
+	{[3]int{-2, -2, -2}, "3 1 2"},
+	{[3]int{-2, -2, -1}, "1 3 2"},
+	{[3]int{-2, -2, 0}, "1 2 3"},
+	{[3]int{-2, -2, 1}, "1 2 3"},
+	{[3]int{-2, -2, 2}, "1 2 3"},
+	{[3]int{-2, -1, -2}, "2 1 3"},
+	{[3]int{-2, -1, -1}, "2 3 1"},
+	{[3]int{-2, -1, 0}, "2 1 3"},
+	{[3]int{-2, -1, 1}, "2 1 3"},
+	{[3]int{-2, -1, 2}, "2 1 3"},
+	{[3]int{-2, 0, -2}, "3 2 1"},
+	{[3]int{-2, 0, -1}, "1 2 3"},
+	{[3]int{-2, 0, 0}, "1 2 3"},
+	{[3]int{-2, 0, 1}, "1 2 3"},
+	{[3]int{-2, 0, 2}, "1 2 3"},
+	{[3]int{-2, 1, -2}, "3 1 2"},
+	{[3]int{-2, 1, -1}, "1 3 2"},
+	{[3]int{-2, 1, 0}, "1 3 2"},
+	{[3]int{-2, 1, 1}, "1 3 2"},
+	{[3]int{-2, 1, 2}, "1 3 2"},
+	{[3]int{-2, 2, -2}, "3 1 2"},
+	{[3]int{-2, 2, -1}, "1 3 2"},
+	{[3]int{-2, 2, 0}, "1 2 3"},
+	{[3]int{-2, 2, 1}, "1 2 3"},
+	{[3]int{-2, 2, 2}, "1 2 3"},
+	{[3]int{-1, -2, -2}, "3 1 2"},
+	{[3]int{-1, -2, -1}, "1 3 2"},
+	{[3]int{-1, -2, 0}, "1 2 3"},
+	{[3]int{-1, -2, 1}, "1 2 3"},
+	{[3]int{-1, -2, 2}, "1 2 3"},
+	{[3]int{-1, -1, -2}, "2 1 3"},
+	{[3]int{-1, -1, -1}, "2 3 1"},
+	{[3]int{-1, -1, 0}, "2 1 3"},
+	{[3]int{-1, -1, 1}, "2 1 3"},
+	{[3]int{-1, -1, 2}, "2 1 3"},
+	{[3]int{-1, 0, -2}, "3 2 1"},
+	{[3]int{-1, 0, -1}, "1 2 3"},
+	{[3]int{-1, 0, 0}, "1 2 3"},
+	{[3]int{-1, 0, 1}, "1 2 3"},
+	{[3]int{-1, 0, 2}, "1 2 3"},
+	{[3]int{-1, 1, -2}, "3 1 2"},
+	{[3]int{-1, 1, -1}, "1 3 2"},
+	{[3]int{-1, 1, 0}, "1 3 2"},
+	{[3]int{-1, 1, 1}, "1 3 2"},
+	{[3]int{-1, 1, 2}, "1 3 2"},
+	{[3]int{-1, 2, -2}, "3 1 2"},
+	{[3]int{-1, 2, -1}, "1 3 2"},
+	{[3]int{-1, 2, 0}, "1 2 3"},
+	{[3]int{-1, 2, 1}, "1 2 3"},
+	{[3]int{-1, 2, 2}, "1 2 3"},
+	{[3]int{0, -2, -2}, "1 2 3"},
+	{[3]int{0, -2, -1}, "1 3 2"},
+	{[3]int{0, -2, 0}, "1 2 3"},
+	{[3]int{0, -2, 1}, "1 2 3"},
+	{[3]int{0, -2, 2}, "1 2 3"},
+	{[3]int{0, -1, -2}, "1 2 3"},
+	{[3]int{0, -1, -1}, "1 3 2"},
+	{[3]int{0, -1, 0}, "1 2 3"},
+	{[3]int{0, -1, 1}, "1 2 3"},
+	{[3]int{0, -1, 2}, "1 2 3"},
+	{[3]int{0, 0, -2}, "1 2 3"},
+	{[3]int{0, 0, -1}, "1 2 3"},
+	{[3]int{0, 0, 0}, "1 2 3"},
+	{[3]int{0, 0, 1}, "1 2 3"},
+	{[3]int{0, 0, 2}, "1 2 3"},
+	{[3]int{0, 1, -2}, "1 3 2"},
+	{[3]int{0, 1, -1}, "1 3 2"},
+	{[3]int{0, 1, 0}, "1 3 2"},
+	{[3]int{0, 1, 1}, "1 3 2"},
+	{[3]int{0, 1, 2}, "1 3 2"},
+	{[3]int{0, 2, -2}, "1 2 3"},
+	{[3]int{0, 2, -1}, "1 3 2"},
+	{[3]int{0, 2, 0}, "1 2 3"},
+	{[3]int{0, 2, 1}, "1 2 3"},
+	{[3]int{0, 2, 2}, "1 2 3"},
+	{[3]int{1, -2, -2}, "3 1 2"},
+	{[3]int{1, -2, -1}, "2 1 3"},
+	{[3]int{1, -2, 0}, "2 1 3"},
+	{[3]int{1, -2, 1}, "2 1 3"},
+	{[3]int{1, -2, 2}, "2 1 3"},
+	{[3]int{1, -1, -2}, "2 1 3"},
+	{[3]int{1, -1, -1}, "2 1 3"},
+	{[3]int{1, -1, 0}, "2 1 3"},
+	{[3]int{1, -1, 1}, "2 1 3"},
+	{[3]int{1, -1, 2}, "2 1 3"},
+	{[3]int{1, 0, -2}, "3 1 2"},
+	{[3]int{1, 0, -1}, "2 1 3"},
+	{[3]int{1, 0, 0}, "2 1 3"},
+	{[3]int{1, 0, 1}, "2 1 3"},
+	{[3]int{1, 0, 2}, "2 1 3"},
+	{[3]int{1, 1, -2}, "3 1 2"},
+	{[3]int{1, 1, -1}, "3 1 2"},
+	{[3]int{1, 1, 0}, "3 1 2"},
+	{[3]int{1, 1, 1}, "3 1 2"},
+	{[3]int{1, 1, 2}, "3 1 2"},
+	{[3]int{1, 2, -2}, "3 1 2"},
+	{[3]int{1, 2, -1}, "2 1 3"},
+	{[3]int{1, 2, 0}, "2 1 3"},
+	{[3]int{1, 2, 1}, "2 1 3"},
+	{[3]int{1, 2, 2}, "2 1 3"},
+	{[3]int{2, -2, -2}, "3 2 1"},
+	{[3]int{2, -2, -1}, "2 3 1"},
+	{[3]int{2, -2, 0}, "2 3 1"},
+	{[3]int{2, -2, 1}, "2 3 1"},
+	{[3]int{2, -2, 2}, "2 3 1"},
+	{[3]int{2, -1, -2}, "2 3 1"},
+	{[3]int{2, -1, -1}, "2 3 1"},
+	{[3]int{2, -1, 0}, "2 3 1"},
+	{[3]int{2, -1, 1}, "2 3 1"},
+	{[3]int{2, -1, 2}, "2 3 1"},
+	{[3]int{2, 0, -2}, "3 2 1"},
+	{[3]int{2, 0, -1}, "3 2 1"},
+	{[3]int{2, 0, 0}, "3 2 1"},
+	{[3]int{2, 0, 1}, "3 2 1"},
+	{[3]int{2, 0, 2}, "3 2 1"},
+	{[3]int{2, 1, -2}, "3 2 1"},
+	{[3]int{2, 1, -1}, "2 3 1"},
+	{[3]int{2, 1, 0}, "2 3 1"},
+	{[3]int{2, 1, 1}, "2 3 1"},
+	{[3]int{2, 1, 2}, "2 3 1"},
+	{[3]int{2, 2, -2}, "3 2 1"},
+	{[3]int{2, 2, -1}, "2 3 1"},
+	{[3]int{2, 2, 0}, "2 3 1"},
+	{[3]int{2, 2, 1}, "2 3 1"},
+	{[3]int{2, 2, 2}, "2 3 1"},
+}
+
+func changesOf(changes []int) []Change {
+	cs := make([]Change, len(changes))
+	for i, c := range changes {
+		cs[i] = Change{DancerNo: i + 1, Change: c}
+	}
+	return cs
+}
+
+func isPermutation(positions []int) bool {
+	seen := make(map[int]bool)
+	for _, dNo := range positions {
+		if dNo < 1 || dNo > len(positions) || seen[dNo] {
+			return false
+		}
+		seen[dNo] = true
+	}
+	return true
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range applyTests {
+		tracker := NewPositionTracker(3, OrderedResolver)
+		got := tracker.Apply(changesOf(tt.changes[:]))
+		if s := FormatPositions(got); s != tt.want {
+			t.Errorf("Apply(%v) = %q, want %q", tt.changes, s, tt.want)
+		}
+		if tracker.String() != tt.want {
+			t.Errorf("Apply(%v) then String() = %q, want %q", tt.changes, tracker.String(), tt.want)
+		}
+		for place, dNo := range got {
+			if tracker.Place(dNo) != place+1 {
+				t.Errorf("Apply(%v) then Place(%d) = %d, want %d", tt.changes, dNo, tracker.Place(dNo), place+1)
+			}
+		}
+	}
+}
+
+func TestApplyMissingChangesStay(t *testing.T) {
+	tracker := NewPositionTracker(4, OrderedResolver)
+	got := tracker.Apply([]Change{{DancerNo: 2, Change: 1}, {DancerNo: 3, Change: -1}})
+	if want := []int{1, 3, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply = %v, want %v", got, want)
+	}
+}
+
+func TestApplyAfterReset(t *testing.T) {
+	tracker := NewPositionTracker(3, OrderedResolver)
+	if err := tracker.Reset([]int{3, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	// dancer 3 is leftmost, dancer 2 rightmost, they swap ends
+	got := tracker.Apply(changesOf([]int{0, -2, 2}))
+	if want := []int{2, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply = %v, want %v", got, want)
+	}
+}
+
+func TestRandomResolver(t *testing.T) {
+	for _, tt := range applyTests {
+		tracker := NewPositionTracker(3, RandomResolver)
+		got := tracker.Apply(changesOf(tt.changes[:]))
+		if !isPermutation(got) {
+			t.Fatalf("Apply(%v) = %v, not a permutation of 1 2 3", tt.changes, got)
+		}
+		// Dancers landing in range and unclaimed are placed the same way whatever the resolver
+		claimed := make(map[int]bool)
+		for dNo := 1; dNo <= 3; dNo++ {
+			target := dNo + tt.changes[dNo-1]
+			if target < 1 || target > 3 || claimed[target] {
+				continue
+			}
+			claimed[target] = true
+			if tracker.Place(dNo) != target {
+				t.Errorf("Apply(%v) placed dancer %d in %d, want %d", tt.changes, dNo, tracker.Place(dNo), target)
+			}
+		}
+	}
+}
+
+func TestResolvers(t *testing.T) {
+	unplaced := []int{2, 5, 7}
+	free := []int{1, 4, 6}
+
+	if got, want := OrderedResolver(unplaced, free), map[int]int{2: 1, 5: 4, 7: 6}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OrderedResolver = %v, want %v", got, want)
+	}
+
+	got := RandomResolver(unplaced, free)
+	if len(got) != len(unplaced) {
+		t.Fatalf("RandomResolver = %v, want %d dancers assigned", got, len(unplaced))
+	}
+	used := make(map[int]bool)
+	for _, dNo := range unplaced {
+		place, ok := got[dNo]
+		if !ok {
+			t.Errorf("RandomResolver left dancer %d unassigned", dNo)
+		}
+		if used[place] {
+			t.Errorf("RandomResolver assigned place %d twice", place)
+		}
+		used[place] = true
+	}
+	for _, place := range free {
+		if !used[place] {
+			t.Errorf("RandomResolver left place %d free", place)
+		}
+	}
+}
+
+func TestNilResolverDefaultsToRandom(t *testing.T) {
+	tracker := NewPositionTracker(3, nil)
+	if got := tracker.Apply(changesOf([]int{-2, 0, 2})); !isPermutation(got) {
+		t.Errorf("Apply = %v, not a permutation of 1 2 3", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions []int
+		wantErr   bool
+	}{
+		{"valid", []int{2, 3, 1}, false},
+		{"initial", []int{1, 2, 3}, false},
+		{"too few", []int{1, 2}, true},
+		{"too many", []int{1, 2, 3, 4}, true},
+		{"duplicate", []int{1, 1, 3}, true},
+		{"zero", []int{0, 1, 2}, true},
+		{"out of range", []int{1, 2, 4}, true},
+	}
+	for _, tt := range tests {
+		tracker := NewPositionTracker(3, OrderedResolver)
+		tracker.Apply(changesOf([]int{1, -1, 0})) // 2 1 3
+		before := tracker.Positions()
+
+		err := tracker.Reset(tt.positions)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Reset(%v) error = %v, wantErr %v", tt.name, tt.positions, err, tt.wantErr)
+			continue
+		}
+		want := tt.positions
+		if tt.wantErr {
+			want = before // left untouched
+		}
+		if got := tracker.Positions(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Reset(%v) then Positions() = %v, want %v", tt.name, tt.positions, got, want)
+		}
+		for place, dNo := range want {
+			if tracker.Place(dNo) != place+1 {
+				t.Errorf("%s: Place(%d) = %d, want %d", tt.name, dNo, tracker.Place(dNo), place+1)
+			}
+		}
+	}
+}
+
+func TestShuffle(t *testing.T) {
+	tracker := NewPositionTracker(5, nil)
+	if got := tracker.Shuffle(); !isPermutation(got) || !reflect.DeepEqual(got, tracker.Positions()) {
+		t.Errorf("Shuffle = %v, Positions() = %v", got, tracker.Positions())
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Policy
+		wantErr bool
+	}{
+		{"strict", StrictPolicy, false},
+		{"ignore", IgnorePolicy, false},
+		{"repair", RepairPolicy, false},
+		{"", "", true},
+		{"Strict", "", true},
+		{"random", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePolicy(%q) = %q, %v, want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []int
+		want    []int
+		wantOk  bool
+	}{
+		{"consistent", []int{1, -1, 0}, []int{1, -1, 0}, true},
+		{"all stay", []int{0, 0, 0}, []int{0, 0, 0}, true},
+		{"single stray right", []int{1, -1, 2}, []int{1, -1, 0}, true},
+		{"single stray left", []int{-1, 0, 0}, []int{0, 0, 0}, true},
+		{"first of several matching is repaired", []int{1, 1, 0, -1}, []int{0, 1, 0, -1}, true},
+		{"no single dancer accounts for sum", []int{1, 1, 0}, []int{1, 1, 0}, false},
+		{"sum out of any change's range", []int{2, 2, 0}, []int{2, 2, 0}, false},
+		{"opposite signs", []int{2, -1, 2}, []int{2, -1, 2}, false},
+	}
+	for _, tt := range tests {
+		changes := changesOf(tt.changes)
+		got, ok := Repair(changes)
+		if ok != tt.wantOk {
+			t.Errorf("%s: Repair(%v) ok = %v, want %v", tt.name, tt.changes, ok, tt.wantOk)
+		}
+		if !reflect.DeepEqual(got, changesOf(tt.want)) {
+			t.Errorf("%s: Repair(%v) = %v, want %v", tt.name, tt.changes, got, tt.want)
+		}
+		if ok && SumChanges(got) != 0 {
+			t.Errorf("%s: Repair(%v) sum = %d, want 0", tt.name, tt.changes, SumChanges(got))
+		}
+		if !reflect.DeepEqual(changes, changesOf(tt.changes)) {
+			t.Errorf("%s: Repair modified its input to %v", tt.name, changes)
+		}
+	}
+}
+
+func TestFormatParsePositions(t *testing.T) {
+	got, err := ParsePositions(" 2 1  3 ")
+	if err != nil || !reflect.DeepEqual(got, []int{2, 1, 3}) {
+		t.Errorf("ParsePositions = %v, %v, want [2 1 3]", got, err)
+	}
+	if s := FormatPositions(got); s != "2 1 3" {
+		t.Errorf("FormatPositions = %q, want %q", s, "2 1 3")
+	}
+	if _, err := ParsePositions("2 x 3"); err == nil {
+		t.Error("ParsePositions(\"2 x 3\") returned no error")
+	}
+}
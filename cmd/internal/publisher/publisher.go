@@ -0,0 +1,234 @@
+package publisher
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	minBackoff     = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+	publishTimeout = 5 * time.Second
+	retryInterval  = time.Second
+)
+
+// Errors passed to the done callback of PublishNotify
+var (
+	ErrDropped = errors.New("publisher: dropped, queue full")
+	ErrStopped = errors.New("publisher: stopped before publishing")
+)
+
+type message struct {
+	id       uint64
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+	encode   func() []byte // builds payload right before every publish attempt if set
+	done     func(error)   // optional
+}
+
+// Publisher : MQTT publisher which never blocks the caller
+// Messages are queued in memory and published in order whenever the broker connection is up,
+// messages queued while disconnected are replayed unchanged on reconnect
+// Once the queue is full the oldest message is dropped
+type Publisher struct {
+	client   mqtt.Client
+	capacity int
+
+	mu      sync.Mutex
+	queue   []message
+	nextID  uint64
+	dropped uint64
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+// New : Returns a Publisher for opts buffering at most capacity messages
+// Auto reconnect is enabled on opts, call Start to connect
+func New(opts *mqtt.ClientOptions, capacity int) *Publisher {
+	p := &Publisher{
+		capacity: capacity,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(maxBackoff)
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		log.Warn("Lost connection to MQTT Broker, buffering readings | ", err)
+	})
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Info("Connected to MQTT Broker, ", p.Len(), " buffered readings to replay")
+		p.notify()
+	})
+	p.client = mqtt.NewClient(opts)
+	return p
+}
+
+// Start : Connects to the broker, retrying with exponential backoff, and starts publishing queued messages
+func (p *Publisher) Start() {
+	go p.connect()
+	go p.run()
+}
+
+// Stop : Waits up to flush for queued messages to be published, then stops publishing and disconnects from the broker
+// Messages still queued after flush are discarded
+func (p *Publisher) Stop(flush time.Duration) {
+	deadline := time.Now().Add(flush)
+	for p.Len() > 0 && time.Now().Before(deadline) {
+		p.notify()
+		time.Sleep(50 * time.Millisecond)
+	}
+	close(p.done)
+	p.client.Disconnect(250)
+
+	p.mu.Lock()
+	discarded := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+	if len(discarded) > 0 {
+		log.Warn("Publisher stopped with ", len(discarded), " unpublished readings")
+	}
+	for _, msg := range discarded {
+		if msg.done != nil {
+			msg.done(ErrStopped)
+		}
+	}
+}
+
+// Publish : Queues payload for publishing to topic
+func (p *Publisher) Publish(topic string, qos byte, retained bool, payload []byte) {
+	p.PublishNotify(topic, qos, retained, payload, nil)
+}
+
+// PublishNotify : Queues payload for publishing to topic, done is called once the publish completed with nil,
+// or with ErrDropped or ErrStopped if it never will, done must not block
+func (p *Publisher) PublishNotify(topic string, qos byte, retained bool, payload []byte, done func(error)) {
+	p.enqueue(message{topic: topic, qos: qos, retained: retained, payload: payload, done: done})
+}
+
+// PublishEncode : Same as PublishNotify but the payload is built by encode right before every publish attempt,
+// ie: to stamp the time it was actually published, encode is only ever called from a single goroutine
+func (p *Publisher) PublishEncode(topic string, qos byte, retained bool, encode func() []byte, done func(error)) {
+	p.enqueue(message{topic: topic, qos: qos, retained: retained, encode: encode, done: done})
+}
+
+func (p *Publisher) enqueue(msg message) {
+	var evicted message
+	p.mu.Lock()
+	if len(p.queue) >= p.capacity {
+		evicted = p.queue[0]
+		p.queue = p.queue[1:]
+		p.dropped++
+		if p.dropped == 1 || p.dropped%100 == 0 {
+			log.Warn("Reading buffer full, dropped ", p.dropped, " oldest readings so far")
+		}
+	}
+	p.nextID++
+	msg.id = p.nextID
+	p.queue = append(p.queue, msg)
+	p.mu.Unlock()
+	if evicted.done != nil {
+		evicted.done(ErrDropped)
+	}
+	p.notify()
+}
+
+// Len : Returns number of queued messages
+func (p *Publisher) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// Cap : Returns max number of queued messages
+func (p *Publisher) Cap() int {
+	return p.capacity
+}
+
+// Dropped : Returns number of messages dropped because the queue was full
+func (p *Publisher) Dropped() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dropped
+}
+
+// Connected : Returns true if the broker connection is currently up
+func (p *Publisher) Connected() bool {
+	return p.client.IsConnectionOpen()
+}
+
+func (p *Publisher) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Publisher) connect() {
+	backoff := minBackoff
+	for {
+		token := p.client.Connect()
+		if token.Wait() && token.Error() == nil {
+			return
+		}
+		log.Error("Could not connect to MQTT Broker, retrying in ", backoff, " | ", token.Error())
+		select {
+		case <-time.After(backoff):
+		case <-p.done:
+			return
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (p *Publisher) run() {
+	retry := time.NewTicker(retryInterval)
+	defer retry.Stop()
+	for {
+		select {
+		case <-p.wake:
+		case <-retry.C:
+		case <-p.done:
+			return
+		}
+		for p.client.IsConnectionOpen() {
+			p.mu.Lock()
+			if len(p.queue) == 0 {
+				p.mu.Unlock()
+				break
+			}
+			msg := p.queue[0]
+			p.mu.Unlock()
+
+			// QoS 0 publishes are silently discarded by paho while reconnecting, so only pop once the publish completed
+			payload := msg.payload
+			if msg.encode != nil {
+				payload = msg.encode()
+			}
+			token := p.client.Publish(msg.topic, msg.qos, msg.retained, payload)
+			if !token.WaitTimeout(publishTimeout) || token.Error() != nil {
+				log.Warn("Publish failed, will retry on reconnect | ", token.Error())
+				break
+			}
+
+			p.mu.Lock()
+			popped := len(p.queue) > 0 && p.queue[0].id == msg.id
+			if popped {
+				p.queue = p.queue[1:]
+			}
+			p.mu.Unlock()
+			if popped && msg.done != nil { // dropped while publishing otherwise, done was already called
+				msg.done(nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package segment
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/QzSG/lapis-uno/protobuf"
+)
+
+// DancerWindow : Start and end of a single dancer's move
+type DancerWindow struct {
+	MoveID    int
+	ClientID  string
+	DancerNo  int32
+	PosChange int32
+	Start     int64 // timestamp of earliest start packet, unix nanoseconds
+	End       int64 // timestamp of first idle packet after start, 0 if none arrived before the window closed
+}
+
+// MoveWindow : A single move across all dancers that started it
+type MoveWindow struct {
+	ID       int
+	Dancers  []DancerWindow // ordered by Start
+	TimedOut bool           // true if closed by timeout rather than every dancer going idle
+}
+
+// Segmenter : Splits the reading stream of every dancer into move windows
+// Each dancer's window is tracked independently, a dancer's window starts at its first start packet and ends at its first idle packet
+// A move window closes once every dancer has ended, after the timeout, or once a dancer that already ended starts the next move
+// Readings arriving out of order within a window are tolerated, start uses the earliest start packet seen
+type Segmenter struct {
+	mu      sync.Mutex
+	dancers int
+	timeout time.Duration
+	starts  chan<- DancerWindow
+	windows chan<- MoveWindow
+
+	nextID  int
+	current *window
+}
+
+type window struct {
+	id      int
+	opened  time.Time
+	dancers map[string]*DancerWindow
+}
+
+// New : Returns a Segmenter for a group of dancers
+// starts receives each dancer's window as soon as its first start packet arrives, windows receives every closed move window
+// Either channel may be nil. Add and Tick block until their windows are received, so do not call them from the goroutine reading the channels
+func New(dancers int, timeout time.Duration, starts chan<- DancerWindow, windows chan<- MoveWindow) *Segmenter {
+	return &Segmenter{
+		dancers: dancers,
+		timeout: timeout,
+		starts:  starts,
+		windows: windows,
+	}
+}
+
+// Add : Feeds a reading received at now into the segmenter
+func (s *Segmenter) Add(reading *pb.Reading, now time.Time) {
+	var starts []DancerWindow
+	var closed []MoveWindow
+
+	s.mu.Lock()
+	cid := reading.GetClientID()
+	ts := reading.GetTimeStamp()
+	if reading.GetIsStartMove() {
+		if s.current != nil {
+			if dw, ok := s.current.dancers[cid]; ok && dw.End != 0 && ts > dw.End {
+				// Dancer has already finished this move and is starting the next one
+				closed = append(closed, s.close(false))
+			}
+		}
+		if s.current == nil {
+			s.nextID++
+			s.current = &window{id: s.nextID, opened: now, dancers: make(map[string]*DancerWindow)}
+		}
+		if dw, ok := s.current.dancers[cid]; ok {
+			if ts < dw.Start {
+				dw.Start = ts
+			}
+		} else {
+			dw := &DancerWindow{
+				MoveID:    s.current.id,
+				ClientID:  cid,
+				DancerNo:  reading.GetDancerNo(),
+				PosChange: reading.GetPosChange(),
+				Start:     ts,
+			}
+			s.current.dancers[cid] = dw
+			starts = append(starts, *dw)
+		}
+	} else if s.current != nil {
+		if dw, ok := s.current.dancers[cid]; ok && ts > dw.Start && (dw.End == 0 || ts < dw.End) {
+			dw.End = ts
+			if s.allEnded() {
+				closed = append(closed, s.close(false))
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	s.emit(starts, closed)
+}
+
+// Tick : Closes the current move window if it has been open for longer than the timeout, call periodically
+func (s *Segmenter) Tick(now time.Time) {
+	var closed []MoveWindow
+
+	s.mu.Lock()
+	if s.current != nil && now.Sub(s.current.opened) > s.timeout {
+		closed = append(closed, s.close(true))
+	}
+	s.mu.Unlock()
+
+	s.emit(nil, closed)
+}
+
+func (s *Segmenter) allEnded() bool {
+	if len(s.current.dancers) < s.dancers {
+		return false
+	}
+	for _, dw := range s.current.dancers {
+		if dw.End == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// close : Closes current window, caller must hold s.mu
+func (s *Segmenter) close(timedOut bool) MoveWindow {
+	mw := MoveWindow{ID: s.current.id, TimedOut: timedOut}
+	for _, dw := range s.current.dancers {
+		mw.Dancers = append(mw.Dancers, *dw)
+	}
+	sort.Slice(mw.Dancers, func(i, j int) bool { return mw.Dancers[i].Start < mw.Dancers[j].Start })
+	s.current = nil
+	return mw
+}
+
+func (s *Segmenter) emit(starts []DancerWindow, closed []MoveWindow) {
+	// Window closes are sent before starts as a start may belong to the window opened right after
+	for _, mw := range closed {
+		if s.windows != nil {
+			s.windows <- mw
+		}
+	}
+	for _, dw := range starts {
+		if s.starts != nil {
+			s.starts <- dw
+		}
+	}
+}
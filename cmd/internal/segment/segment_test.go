@@ -0,0 +1,125 @@
+package segment
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/QzSG/lapis-uno/protobuf"
+)
+
+func reading(clientID string, start bool, ts int64) *pb.Reading {
+	return &pb.Reading{ClientID: clientID, IsStartMove: start, TimeStamp: ts}
+}
+
+func newSegmenter(dancers int) (*Segmenter, chan DancerWindow, chan MoveWindow) {
+	starts := make(chan DancerWindow, 100)
+	windows := make(chan MoveWindow, 100)
+	return New(dancers, time.Second, starts, windows), starts, windows
+}
+
+func expectWindow(t *testing.T, windows chan MoveWindow) MoveWindow {
+	t.Helper()
+	select {
+	case mw := <-windows:
+		return mw
+	default:
+		t.Fatal("no window closed")
+		return MoveWindow{}
+	}
+}
+
+func expectNoWindow(t *testing.T, windows chan MoveWindow) {
+	t.Helper()
+	select {
+	case mw := <-windows:
+		t.Fatalf("unexpected window %+v", mw)
+	default:
+	}
+}
+
+func TestWindowClosesOnceAllIdle(t *testing.T) {
+	s, starts, windows := newSegmenter(2)
+	now := time.Now()
+	s.Add(reading("1", true, 100), now)
+	s.Add(reading("2", true, 150), now)
+	s.Add(reading("1", false, 200), now)
+	expectNoWindow(t, windows)
+	s.Add(reading("2", false, 300), now)
+
+	mw := expectWindow(t, windows)
+	if mw.ID != 1 || mw.TimedOut || len(mw.Dancers) != 2 {
+		t.Fatalf("window = %+v, want move 1 of 2 dancers not timed out", mw)
+	}
+	if d := mw.Dancers[0]; d.ClientID != "1" || d.Start != 100 || d.End != 200 {
+		t.Errorf("first dancer = %+v, want 1 from 100 to 200", d)
+	}
+	if d := mw.Dancers[1]; d.ClientID != "2" || d.Start != 150 || d.End != 300 {
+		t.Errorf("second dancer = %+v, want 2 from 150 to 300", d)
+	}
+	if len(starts) != 2 {
+		t.Errorf("%d starts sent, want 2", len(starts))
+	}
+}
+
+func TestEarliestStartKept(t *testing.T) {
+	s, starts, windows := newSegmenter(1)
+	now := time.Now()
+	s.Add(reading("1", true, 200), now)
+	s.Add(reading("1", true, 100), now) // arrived out of order
+	s.Add(reading("1", true, 300), now)
+	s.Add(reading("1", false, 400), now)
+
+	mw := expectWindow(t, windows)
+	if d := mw.Dancers[0]; d.Start != 100 || d.End != 400 {
+		t.Errorf("dancer = %+v, want from 100 to 400", d)
+	}
+	if len(starts) != 1 {
+		t.Errorf("%d starts sent, want only the first", len(starts))
+	}
+}
+
+func TestTickClosesTimedOutWindow(t *testing.T) {
+	s, _, windows := newSegmenter(2)
+	now := time.Now()
+	s.Add(reading("1", true, 100), now)
+	s.Tick(now.Add(time.Second / 2))
+	expectNoWindow(t, windows)
+	s.Tick(now.Add(2 * time.Second))
+
+	mw := expectWindow(t, windows)
+	if !mw.TimedOut || len(mw.Dancers) != 1 || mw.Dancers[0].End != 0 {
+		t.Errorf("window = %+v, want timed out with dancer 1 and no idle packet", mw)
+	}
+}
+
+func TestNextMoveClosesWindow(t *testing.T) {
+	s, _, windows := newSegmenter(2)
+	now := time.Now()
+	s.Add(reading("1", true, 100), now)
+	s.Add(reading("1", false, 200), now)
+	s.Add(reading("1", true, 300), now) // dancer 2 never moved, dancer 1 starts the next move
+
+	mw := expectWindow(t, windows)
+	if mw.ID != 1 || mw.TimedOut || len(mw.Dancers) != 1 {
+		t.Errorf("window = %+v, want move 1 with only dancer 1", mw)
+	}
+	s.Add(reading("1", false, 400), now)
+	s.Add(reading("2", true, 310), now)
+	s.Add(reading("2", false, 410), now)
+	if mw := expectWindow(t, windows); mw.ID != 2 || len(mw.Dancers) != 2 {
+		t.Errorf("window = %+v, want move 2 of both dancers", mw)
+	}
+}
+
+func TestIdleBeforeStartIgnored(t *testing.T) {
+	s, _, windows := newSegmenter(1)
+	now := time.Now()
+	s.Add(reading("1", false, 50), now)
+	s.Add(reading("1", true, 100), now)
+	s.Add(reading("1", false, 90), now) // older than the start, belongs to the previous idle period
+	expectNoWindow(t, windows)
+	s.Add(reading("1", false, 200), now)
+	if mw := expectWindow(t, windows); mw.Dancers[0].End != 200 {
+		t.Errorf("dancer = %+v, want end 200", mw.Dancers[0])
+	}
+}
@@ -0,0 +1,176 @@
+package sequence
+
+import (
+	"sort"
+	"sync"
+)
+
+// Event : How a reading's sequence number relates to the readings of its client seen before
+type Event int
+
+// Events returned by Observe
+const (
+	InOrder     Event = iota // next expected reading
+	First                    // first reading seen from the client
+	Gap                      // readings between the last one seen and this one are missing
+	Duplicate                // reading was already seen
+	Reordered                // reading arrived after later ones, it was counted as missing before
+	Restart                  // publisher restarted numbering, readings before this one in the new epoch are missing if seq > 1
+	Unsequenced              // reading has no sequence number, ie: from a publisher predating sequence numbers
+)
+
+func (e Event) String() string {
+	switch e {
+	case InOrder:
+		return "in order"
+	case First:
+		return "first"
+	case Gap:
+		return "gap"
+	case Duplicate:
+		return "duplicate"
+	case Reordered:
+		return "reordered"
+	case Restart:
+		return "restart"
+	case Unsequenced:
+		return "unsequenced"
+	}
+	return "unknown"
+}
+
+// Stats : Counters of a single client
+type Stats struct {
+	Received    uint64 `json:"received"`
+	Missing     uint64 `json:"missing"` // skipped readings which have not arrived (yet)
+	Gaps        uint64 `json:"gaps"`    // times readings were skipped
+	Duplicates  uint64 `json:"duplicates"`
+	Reordered   uint64 `json:"reordered"`
+	Restarts    uint64 `json:"restarts"`
+	Unsequenced uint64 `json:"unsequenced"`
+}
+
+type client struct {
+	epoch int64
+	last  uint64   // highest seq seen in epoch
+	seen  []uint64 // seen[seq % window] == seq if seq was seen, covers (last - window, last]
+	stats Stats
+}
+
+// Tracker : Tracks sequence numbers of readings per client to count gaps, duplicates and reordering
+// Only the last window sequence numbers of a client are remembered, an older reading is counted as reordered
+// without checking whether it is a duplicate, as is a reading from an epoch before the current one
+type Tracker struct {
+	mu      sync.Mutex
+	window  uint64
+	clients map[string]*client
+}
+
+// NewTracker : Returns a Tracker remembering the last window sequence numbers of each client
+func NewTracker(window int) *Tracker {
+	if window < 1 {
+		window = 1
+	}
+	return &Tracker{window: uint64(window), clients: make(map[string]*client)}
+}
+
+// Observe : Records reading seq of clientID numbered in epoch
+// Returns how it relates to the readings seen before and, for Gap and Restart, the number of readings skipped
+func (t *Tracker) Observe(clientID string, epoch int64, seq uint64) (Event, uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.clients[clientID]
+	if !ok {
+		c = &client{}
+		t.clients[clientID] = c
+	}
+	c.stats.Received++
+	if seq == 0 {
+		c.stats.Unsequenced++
+		return Unsequenced, 0
+	}
+
+	switch {
+	case !ok || c.seen == nil:
+		// Joined mid stream, readings before this one were never expected
+		c.reset(epoch, seq, t.window)
+		return First, 0
+	case epoch < c.epoch:
+		// Straggler from before the publisher restarted, epochs are start times so they only grow
+		c.stats.Reordered++
+		return Reordered, 0
+	case epoch != c.epoch:
+		c.stats.Restarts++
+		c.reset(epoch, 0, t.window)
+		skipped := c.advance(seq, t.window)
+		return Restart, skipped
+	case seq > c.last:
+		if skipped := c.advance(seq, t.window); skipped > 0 {
+			return Gap, skipped
+		}
+		return InOrder, 0
+	case seq+t.window <= c.last:
+		// Too old to tell apart from a duplicate
+		c.stats.Reordered++
+		if c.stats.Missing > 0 {
+			c.stats.Missing--
+		}
+		return Reordered, 0
+	case c.seen[seq%t.window] == seq:
+		c.stats.Duplicates++
+		return Duplicate, 0
+	default:
+		c.seen[seq%t.window] = seq
+		c.stats.Reordered++
+		if c.stats.Missing > 0 {
+			c.stats.Missing--
+		}
+		return Reordered, 0
+	}
+}
+
+// reset : Starts epoch with last as the highest seq seen
+func (c *client) reset(epoch int64, last uint64, window uint64) {
+	c.epoch = epoch
+	c.last = last
+	c.seen = make([]uint64, window)
+	if last > 0 {
+		c.seen[last%window] = last
+	}
+}
+
+// advance : Moves last to seq, returns number of readings skipped
+func (c *client) advance(seq uint64, window uint64) uint64 {
+	skipped := seq - c.last - 1
+	if skipped > 0 {
+		c.stats.Gaps++
+		c.stats.Missing += skipped
+	}
+	c.last = seq
+	c.seen[seq%window] = seq
+	return skipped
+}
+
+// Stats : Returns counters of every client seen
+func (t *Tracker) Stats() map[string]Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make(map[string]Stats, len(t.clients))
+	for id, c := range t.clients {
+		stats[id] = c.stats
+	}
+	return stats
+}
+
+// Clients : Returns clientIDs seen, sorted
+func (t *Tracker) Clients() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ids := make([]string, 0, len(t.clients))
+	for id := range t.clients {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
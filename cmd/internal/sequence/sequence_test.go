@@ -0,0 +1,104 @@
+package sequence
+
+import "testing"
+
+type observation struct {
+	epoch   int64
+	seq     uint64
+	event   Event
+	skipped uint64
+}
+
+// observeTests : Readings of a single client in arrival order, observed with a window of 4
+var observeTests = []struct {
+	name  string
+	obs   []observation
+	stats Stats
+}{
+	{"in order", []observation{
+		{1, 1, First, 0},
+		{1, 2, InOrder, 0},
+		{1, 3, InOrder, 0},
+	}, Stats{Received: 3}},
+	{"joined mid stream", []observation{
+		{1, 40, First, 0},
+		{1, 41, InOrder, 0},
+	}, Stats{Received: 2}},
+	{"gap", []observation{
+		{1, 1, First, 0},
+		{1, 4, Gap, 2},
+		{1, 5, InOrder, 0},
+		{1, 7, Gap, 1},
+	}, Stats{Received: 4, Missing: 3, Gaps: 2}},
+	{"duplicate", []observation{
+		{1, 1, First, 0},
+		{1, 2, InOrder, 0},
+		{1, 2, Duplicate, 0},
+		{1, 1, Duplicate, 0},
+	}, Stats{Received: 4, Duplicates: 2}},
+	{"reorder fills gap", []observation{
+		{1, 1, First, 0},
+		{1, 3, Gap, 1},
+		{1, 2, Reordered, 0},
+		{1, 2, Duplicate, 0},
+	}, Stats{Received: 4, Gaps: 1, Reordered: 1, Duplicates: 1}},
+	{"reorder beyond window", []observation{
+		{1, 1, First, 0},
+		{1, 7, Gap, 5},
+		{1, 2, Reordered, 0},
+		{1, 2, Reordered, 0}, // too old to be told apart from a duplicate
+	}, Stats{Received: 4, Missing: 3, Gaps: 1, Reordered: 2}},
+	{"restart", []observation{
+		{1, 1, First, 0},
+		{1, 2, InOrder, 0},
+		{2, 1, Restart, 0},
+		{2, 2, InOrder, 0},
+	}, Stats{Received: 4, Restarts: 1}},
+	{"restart with missing readings", []observation{
+		{1, 5, First, 0},
+		{2, 3, Restart, 2},
+		{2, 1, Reordered, 0},
+	}, Stats{Received: 3, Missing: 1, Gaps: 1, Restarts: 1, Reordered: 1}},
+	{"straggler from previous epoch", []observation{
+		{1, 1, First, 0},
+		{2, 1, Restart, 0},
+		{1, 2, Reordered, 0},
+		{2, 2, InOrder, 0},
+	}, Stats{Received: 4, Restarts: 1, Reordered: 1}},
+	{"unsequenced", []observation{
+		{0, 0, Unsequenced, 0},
+		{1, 1, First, 0},
+		{0, 0, Unsequenced, 0},
+		{1, 2, InOrder, 0},
+	}, Stats{Received: 4, Unsequenced: 2}},
+}
+
+func TestObserve(t *testing.T) {
+	for _, tt := range observeTests {
+		tr := NewTracker(4)
+		for i, o := range tt.obs {
+			event, skipped := tr.Observe("1", o.epoch, o.seq)
+			if event != o.event || skipped != o.skipped {
+				t.Errorf("%s: reading %d (epoch %d seq %d) = %v, %d, want %v, %d", tt.name, i, o.epoch, o.seq, event, skipped, o.event, o.skipped)
+			}
+		}
+		if got := tr.Stats()["1"]; got != tt.stats {
+			t.Errorf("%s: stats = %+v, want %+v", tt.name, got, tt.stats)
+		}
+	}
+}
+
+func TestClientsTrackedSeparately(t *testing.T) {
+	tr := NewTracker(4)
+	tr.Observe("2", 1, 1)
+	tr.Observe("1", 1, 1)
+	if event, _ := tr.Observe("2", 1, 2); event != InOrder {
+		t.Errorf("reading 2 of client 2 = %v, want in order", event)
+	}
+	if event, skipped := tr.Observe("1", 1, 3); event != Gap || skipped != 1 {
+		t.Errorf("reading 3 of client 1 = %v, %d, want gap of 1", event, skipped)
+	}
+	if ids := tr.Clients(); len(ids) != 2 || ids[0] != "1" || ids[1] != "2" {
+		t.Errorf("Clients() = %v, want [1 2]", ids)
+	}
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"time"
 
@@ -22,6 +23,9 @@ func RandFloats(minVal float64, maxVal float64, count int) []float64 {
 func RandReading() *pb.Reading {
 
 	floats := RandFloats(-10.00, 10.00, 6)
+	mag := RandFloats(-50.00, 50.00, 3)
+	quat := RandFloats(-1.00, 1.00, 4)
+	norm := math.Sqrt(quat[0]*quat[0] + quat[1]*quat[1] + quat[2]*quat[2] + quat[3]*quat[3])
 	isStart := false
 	pos := rand.Intn(3)
 	if rand.Intn(2) == 1 {
@@ -40,5 +44,13 @@ func RandReading() *pb.Reading {
 		GyroPitch:   floats[4],
 		GyroYaw:     floats[5],
 		TimeStamp:   time.Now().UnixNano(),
+		Mag:         &pb.Magnetometer{MagX: mag[0], MagY: mag[1], MagZ: mag[2]},
+		Orientation: &pb.Quaternion{W: quat[0] / norm, X: quat[1] / norm, Y: quat[2] / norm, Z: quat[3] / norm},
+		Battery: &pb.Battery{
+			Level:      rand.Float32(),
+			Millivolts: uint32(3300 + rand.Intn(900)),
+			Charging:   rand.Intn(10) == 0,
+		},
+		Config: &pb.SensorConfig{SampleRateHz: 50, AccRangeG: 16, GyroRangeDps: 2000, Firmware: "rand"},
 	}
 }
@@ -0,0 +1,297 @@
+package vote
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rememberClosed : Number of closed round IDs remembered to reject late posts
+const rememberClosed = 64
+
+// Vote : Move predicted for a single dancer in a round
+type Vote struct {
+	ClientID   string
+	Move       string
+	Confidence float64 // 0 to 1, 1 if the dancer did not report one
+	Received   time.Time
+}
+
+// Round : Moves of every dancer for a single move
+type Round struct {
+	ID       int
+	Votes    []Vote   // in order of arrival, at most one per client
+	Missing  []string // clientIDs without a vote, only set if the round timed out
+	TimedOut bool
+}
+
+// Moves : Returns move of every client in the round keyed by clientID
+func (r Round) Moves() map[string]string {
+	moves := make(map[string]string)
+	for _, v := range r.Votes {
+		moves[v.ClientID] = v.Move
+	}
+	return moves
+}
+
+// TieBreak : How a tie between equally voted moves is decided
+type TieBreak string
+
+// Tie break policies
+const (
+	FirstTieBreak  TieBreak = "first"  // move whose first vote arrived earliest
+	LastTieBreak   TieBreak = "last"   // move whose latest vote arrived last
+	LeadTieBreak   TieBreak = "lead"   // move of the lowest clientID among tied moves ie: dancer 1 leads
+	RandomTieBreak TieBreak = "random" // any of the tied moves
+)
+
+// ParseTieBreak : Returns TieBreak named s
+func ParseTieBreak(s string) (TieBreak, error) {
+	switch t := TieBreak(strings.ToLower(s)); t {
+	case FirstTieBreak, LastTieBreak, LeadTieBreak, RandomTieBreak:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown tie break %q, expected first, last, lead or random", s)
+}
+
+// Strategy : How the votes of a round are combined into a single move
+type Strategy string
+
+// Voting strategies
+const (
+	MajorityStrategy Strategy = "majority" // most votes, confidence is ignored
+	WeightedStrategy Strategy = "weighted" // highest sum of confidence
+	HighestStrategy  Strategy = "highest"  // highest single confidence
+)
+
+// ParseStrategy : Returns Strategy named s
+func ParseStrategy(s string) (Strategy, error) {
+	switch st := Strategy(strings.ToLower(s)); st {
+	case MajorityStrategy, WeightedStrategy, HighestStrategy:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown vote strategy %q, expected majority, weighted or highest", s)
+}
+
+// Decision : Move chosen for a round
+type Decision struct {
+	Move     string
+	Score    float64 // votes for majority, summed confidence for weighted, single confidence for highest
+	Strategy Strategy
+	Tied     bool // true if tieBreak had to choose between moves with the same score
+}
+
+// Decide : Returns the move of r with the best score under strategy, ties are decided by tieBreak
+// Only the random tie break is non deterministic
+func Decide(r Round, strategy Strategy, tieBreak TieBreak) Decision {
+	scores := make(map[string]float64)
+	for _, v := range r.Votes {
+		switch strategy {
+		case WeightedStrategy:
+			scores[v.Move] += v.Confidence
+		case HighestStrategy:
+			if best, ok := scores[v.Move]; !ok || v.Confidence > best {
+				scores[v.Move] = v.Confidence
+			}
+		default:
+			scores[v.Move]++
+		}
+	}
+	best := 0.0
+	var tied []string
+	for move, score := range scores {
+		switch {
+		case len(tied) == 0 || score > best:
+			best = score
+			tied = []string{move}
+		case score == best:
+			tied = append(tied, move)
+		}
+	}
+	if strategy != WeightedStrategy && strategy != HighestStrategy {
+		strategy = MajorityStrategy
+	}
+	if len(tied) == 0 {
+		return Decision{Strategy: strategy}
+	}
+	return Decision{Move: breakTie(r, tied, tieBreak), Score: best, Strategy: strategy, Tied: len(tied) > 1}
+}
+
+// breakTie : Picks one of tied moves, tied moves must have at least one vote in r
+func breakTie(r Round, tied []string, tieBreak TieBreak) string {
+	sort.Strings(tied) // map iteration order must not leak into the result
+	if len(tied) == 1 {
+		return tied[0]
+	}
+	isTied := make(map[string]bool)
+	for _, move := range tied {
+		isTied[move] = true
+	}
+
+	switch tieBreak {
+	case LastTieBreak:
+		for i := len(r.Votes) - 1; i >= 0; i-- {
+			if isTied[r.Votes[i].Move] {
+				return r.Votes[i].Move
+			}
+		}
+	case LeadTieBreak:
+		votes := append([]Vote(nil), r.Votes...)
+		sort.SliceStable(votes, func(i, j int) bool { return lessClientID(votes[i].ClientID, votes[j].ClientID) })
+		for _, v := range votes {
+			if isTied[v.Move] {
+				return v.Move
+			}
+		}
+	case RandomTieBreak:
+		return tied[rand.Intn(len(tied))]
+	default:
+		for _, v := range r.Votes {
+			if isTied[v.Move] {
+				return v.Move
+			}
+		}
+	}
+	return tied[0]
+}
+
+// lessClientID : Orders numeric clientIDs numerically ie: 2 before 10, others lexically
+func lessClientID(a, b string) bool {
+	var x, y int
+	_, errA := fmt.Sscan(a, &x)
+	_, errB := fmt.Sscan(b, &y)
+	if errA == nil && errB == nil && x != y {
+		return x < y
+	}
+	return a < b
+}
+
+type round struct {
+	id      int
+	opened  time.Time
+	votes   []Vote
+	clients map[string]bool
+}
+
+// Aggregator : Groups moves posted by each dancer into rounds by move ID
+// A round closes once every dancer has voted or after the timeout with the votes received so far
+// Repeated posts from the same dancer for a round are ignored, as are posts for rounds that already closed
+// Posts without a move ID (0) join the oldest open round the dancer has not voted in, or open a new one
+type Aggregator struct {
+	mu      sync.Mutex
+	clients []string
+	timeout time.Duration
+
+	open      map[int]*round
+	closed    map[int]bool
+	closedIDs []int // oldest first, bounds closed
+	nextID    int
+}
+
+// NewAggregator : Returns an Aggregator for clients ie: 1 2 3
+func NewAggregator(clients []string, timeout time.Duration) *Aggregator {
+	return &Aggregator{
+		clients: clients,
+		timeout: timeout,
+		open:    make(map[int]*round),
+		closed:  make(map[int]bool),
+		nextID:  1,
+	}
+}
+
+// Add : Records move of clientID for round moveID at now
+// Returns the round if this vote completed it, and an error if the vote was rejected
+// confidence is clamped to 0 to 1
+func (a *Aggregator) Add(moveID int, clientID string, move string, confidence float64, now time.Time) (*Round, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if moveID == 0 {
+		moveID = a.implicitID(clientID)
+	}
+	if a.closed[moveID] {
+		return nil, fmt.Errorf("round %d already closed, dropping late move %s from %s", moveID, move, clientID)
+	}
+	r, ok := a.open[moveID]
+	if !ok {
+		r = &round{id: moveID, opened: now, clients: make(map[string]bool)}
+		a.open[moveID] = r
+		if moveID >= a.nextID {
+			a.nextID = moveID + 1
+		}
+	}
+	if r.clients[clientID] {
+		return nil, fmt.Errorf("duplicate move %s from %s for round %d ignored", move, clientID, moveID)
+	}
+	r.clients[clientID] = true
+	if confidence < 0 {
+		confidence = 0
+	} else if confidence > 1 {
+		confidence = 1
+	}
+	r.votes = append(r.votes, Vote{ClientID: clientID, Move: move, Confidence: confidence, Received: now})
+
+	if len(r.clients) < len(a.clients) {
+		return nil, nil
+	}
+	closed := a.close(r, false)
+	return &closed, nil
+}
+
+// Tick : Closes rounds open for longer than the timeout, call periodically
+// Closed rounds are returned oldest first
+func (a *Aggregator) Tick(now time.Time) []Round {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var expired []*round
+	for _, r := range a.open {
+		if now.Sub(r.opened) > a.timeout {
+			expired = append(expired, r)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].id < expired[j].id })
+	closed := make([]Round, len(expired))
+	for i, r := range expired {
+		closed[i] = a.close(r, true)
+	}
+	return closed
+}
+
+// implicitID : Returns ID of the oldest open round clientID has not voted in, or a new round ID, caller must hold a.mu
+func (a *Aggregator) implicitID(clientID string) int {
+	oldest := 0
+	for id, r := range a.open {
+		if !r.clients[clientID] && (oldest == 0 || id < oldest) {
+			oldest = id
+		}
+	}
+	if oldest != 0 {
+		return oldest
+	}
+	return a.nextID
+}
+
+// close : Closes r, caller must hold a.mu
+func (a *Aggregator) close(r *round, timedOut bool) Round {
+	delete(a.open, r.id)
+	a.closed[r.id] = true
+	a.closedIDs = append(a.closedIDs, r.id)
+	if len(a.closedIDs) > rememberClosed {
+		delete(a.closed, a.closedIDs[0])
+		a.closedIDs = a.closedIDs[1:]
+	}
+
+	closed := Round{ID: r.id, Votes: r.votes, TimedOut: timedOut}
+	if timedOut {
+		for _, cid := range a.clients {
+			if !r.clients[cid] {
+				closed.Missing = append(closed.Missing, cid)
+			}
+		}
+	}
+	return closed
+}
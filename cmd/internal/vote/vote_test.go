@@ -0,0 +1,132 @@
+package vote
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var clients = []string{"1", "2", "3"}
+
+func TestRoundClosesOnceAllVoted(t *testing.T) {
+	a := NewAggregator(clients, time.Second)
+	now := time.Now()
+	for i, cid := range clients {
+		r, err := a.Add(1, cid, "rocket", 1, now)
+		if err != nil {
+			t.Fatalf("Add(%s) error: %v", cid, err)
+		}
+		if last := i == len(clients)-1; (r != nil) != last {
+			t.Fatalf("Add(%s) returned round %v, want closed only after the last vote", cid, r)
+		}
+		if r != nil && (r.ID != 1 || r.TimedOut || len(r.Votes) != 3 || r.Missing != nil) {
+			t.Errorf("round = %+v, want round 1 with 3 votes not timed out", r)
+		}
+	}
+	if _, err := a.Add(1, "1", "hair", 1, now); err == nil {
+		t.Errorf("late move for closed round 1 accepted")
+	}
+}
+
+func TestDuplicateVoteIgnored(t *testing.T) {
+	a := NewAggregator(clients, time.Second)
+	now := time.Now()
+	a.Add(1, "1", "rocket", 1, now)
+	if _, err := a.Add(1, "1", "hair", 1, now); err == nil {
+		t.Errorf("duplicate move from 1 accepted")
+	}
+	a.Add(1, "2", "hair", 1, now)
+	r, _ := a.Add(1, "3", "hair", 1, now)
+	if r == nil {
+		t.Fatalf("round not closed after every dancer voted")
+	}
+	if got := r.Moves(); !reflect.DeepEqual(got, map[string]string{"1": "rocket", "2": "hair", "3": "hair"}) {
+		t.Errorf("moves = %v, want the first move of each dancer", got)
+	}
+}
+
+func TestImplicitRounds(t *testing.T) {
+	a := NewAggregator(clients, time.Second)
+	now := time.Now()
+	a.Add(0, "1", "rocket", 1, now) // opens round 1
+	a.Add(0, "1", "hair", 1, now)   // 1 already voted in round 1, opens round 2
+	a.Add(0, "2", "rocket", 1, now)
+	r, _ := a.Add(0, "3", "rocket", 1, now)
+	if r == nil || r.ID != 1 {
+		t.Fatalf("round = %+v, want round 1 closed by the oldest open round", r)
+	}
+	if closed := a.Tick(now.Add(2 * time.Second)); len(closed) != 1 || closed[0].ID != 2 {
+		t.Errorf("Tick closed %+v, want round 2", closed)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	a := NewAggregator(clients, time.Second)
+	now := time.Now()
+	a.Add(2, "2", "rocket", 1, now)
+	a.Add(1, "1", "hair", 1, now.Add(100*time.Millisecond))
+
+	if closed := a.Tick(now.Add(time.Second / 2)); len(closed) != 0 {
+		t.Fatalf("Tick closed %+v before the timeout", closed)
+	}
+	closed := a.Tick(now.Add(2 * time.Second))
+	if len(closed) != 2 || closed[0].ID != 1 || closed[1].ID != 2 {
+		t.Fatalf("Tick closed %+v, want rounds 1 and 2 oldest first", closed)
+	}
+	if r := closed[0]; !r.TimedOut || !reflect.DeepEqual(r.Missing, []string{"2", "3"}) {
+		t.Errorf("round 1 = %+v, want timed out missing 2 and 3", r)
+	}
+	if _, err := a.Add(2, "3", "rocket", 1, now.Add(2*time.Second)); err == nil {
+		t.Errorf("move for timed out round 2 accepted")
+	}
+}
+
+func vote(cid string, move string, confidence float64) Vote {
+	return Vote{ClientID: cid, Move: move, Confidence: confidence}
+}
+
+var decideTests = []struct {
+	name     string
+	votes    []Vote
+	strategy Strategy
+	tieBreak TieBreak
+	want     Decision
+}{
+	{"majority", []Vote{vote("1", "hair", 1), vote("2", "rocket", 1), vote("3", "rocket", 1)},
+		MajorityStrategy, FirstTieBreak, Decision{Move: "rocket", Score: 2, Strategy: MajorityStrategy}},
+	{"weighted", []Vote{vote("1", "hair", 0.9), vote("2", "rocket", 0.3), vote("3", "rocket", 0.4)},
+		WeightedStrategy, FirstTieBreak, Decision{Move: "hair", Score: 0.9, Strategy: WeightedStrategy}},
+	{"highest", []Vote{vote("1", "hair", 0.5), vote("2", "rocket", 0.8), vote("3", "hair", 0.6)},
+		HighestStrategy, FirstTieBreak, Decision{Move: "rocket", Score: 0.8, Strategy: HighestStrategy}},
+	{"unknown strategy is majority", []Vote{vote("1", "hair", 1)},
+		Strategy("bogus"), FirstTieBreak, Decision{Move: "hair", Score: 1, Strategy: MajorityStrategy}},
+	{"tie first", []Vote{vote("3", "zigzag", 1), vote("1", "hair", 1), vote("2", "rocket", 1)},
+		MajorityStrategy, FirstTieBreak, Decision{Move: "zigzag", Score: 1, Strategy: MajorityStrategy, Tied: true}},
+	{"tie last", []Vote{vote("3", "zigzag", 1), vote("1", "hair", 1), vote("2", "rocket", 1)},
+		MajorityStrategy, LastTieBreak, Decision{Move: "rocket", Score: 1, Strategy: MajorityStrategy, Tied: true}},
+	{"tie lead", []Vote{vote("3", "zigzag", 1), vote("1", "hair", 1), vote("2", "rocket", 1)},
+		MajorityStrategy, LeadTieBreak, Decision{Move: "hair", Score: 1, Strategy: MajorityStrategy, Tied: true}},
+	{"tie lead orders clientIDs numerically", []Vote{vote("10", "zigzag", 1), vote("2", "hair", 1)},
+		MajorityStrategy, LeadTieBreak, Decision{Move: "hair", Score: 1, Strategy: MajorityStrategy, Tied: true}},
+	{"tie only among best", []Vote{vote("1", "hair", 1), vote("2", "rocket", 1), vote("3", "rocket", 1), vote("4", "hair", 1), vote("5", "zigzag", 1)},
+		MajorityStrategy, LeadTieBreak, Decision{Move: "hair", Score: 2, Strategy: MajorityStrategy, Tied: true}},
+	{"no votes", nil,
+		MajorityStrategy, FirstTieBreak, Decision{Strategy: MajorityStrategy}},
+}
+
+func TestDecide(t *testing.T) {
+	for _, tt := range decideTests {
+		if got := Decide(Round{Votes: tt.votes}, tt.strategy, tt.tieBreak); got != tt.want {
+			t.Errorf("%s: Decide() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRandomTieBreakPicksTiedMove(t *testing.T) {
+	r := Round{Votes: []Vote{vote("1", "hair", 1), vote("2", "rocket", 1), vote("3", "rocket", 1), vote("4", "hair", 1), vote("5", "zigzag", 1)}}
+	for i := 0; i < 50; i++ {
+		if d := Decide(r, MajorityStrategy, RandomTieBreak); d.Move != "hair" && d.Move != "rocket" {
+			t.Fatalf("Decide() = %+v, want hair or rocket", d)
+		}
+	}
+}
@@ -25,12 +25,77 @@ const (
 // of the legacy proto package is being used.
 const _ = proto.ProtoPackageIsVersion4
 
+type Reply_Status int32
+
+const (
+	// Not set
+	Reply_UNKNOWN Reply_Status = 0
+	// Queued for publishing to the broker, the only success value so clients checking status == 1 keep working
+	Reply_QUEUED Reply_Status = 1
+)
+
+// Enum value maps for Reply_Status.
+var (
+	Reply_Status_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "QUEUED",
+	}
+	Reply_Status_value = map[string]int32{
+		"UNKNOWN": 0,
+		"QUEUED":  1,
+	}
+)
+
+func (x Reply_Status) Enum() *Reply_Status {
+	p := new(Reply_Status)
+	*p = x
+	return p
+}
+
+func (x Reply_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Reply_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_protobuf_reading_proto_enumTypes[0].Descriptor()
+}
+
+func (Reply_Status) Type() protoreflect.EnumType {
+	return &file_protobuf_reading_proto_enumTypes[0]
+}
+
+func (x Reply_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Reply_Status.Descriptor instead.
+func (Reply_Status) EnumDescriptor() ([]byte, []int) {
+	return file_protobuf_reading_proto_rawDescGZIP(), []int{0, 0}
+}
+
 type Reply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Status int32 `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	// Status of the reading or batch this reply is for, backpressure is reported by bufferFull, bufferUsage and backoffMs : Reply_Status|int|Reply_Status
+	Status Reply_Status `protobuf:"varint,1,opt,name=status,proto3,enum=pb.Reply_Status" json:"status,omitempty"`
+	// Stream sequence number of the reading this reply is for, or of the last reading of the batch : uint64|int|uint64
+	// Readings are numbered from 1 per gRPC stream in the order they are sent, ie: the 5th reading sent on a stream is 5
+	// whatever its clientID. This is unrelated to Reading.seq, which DataPublisher numbers per clientID for subscribers
+	StreamSeq uint64 `protobuf:"varint,2,opt,name=streamSeq,proto3" json:"streamSeq,omitempty"`
+	// Every reading up to this stream sequence number was either published to the broker or listed in failedStreamSeqs : uint64|int|uint64
+	AckedStreamSeq uint64 `protobuf:"varint,3,opt,name=ackedStreamSeq,proto3" json:"ackedStreamSeq,omitempty"`
+	// Stream sequence numbers of readings which could not be published since the previous reply, resend them : []uint64|list|RepeatedField<uint64>
+	FailedStreamSeqs []uint64 `protobuf:"varint,4,rep,packed,name=failedStreamSeqs,proto3" json:"failedStreamSeqs,omitempty"`
+	// Indicates if DataPublisher is connected to the broker, readings are buffered while it is not : bool|bool|bool
+	BrokerConnected bool `protobuf:"varint,5,opt,name=brokerConnected,proto3" json:"brokerConnected,omitempty"`
+	// Fraction of the publish buffer in use from 0 to 1 : float32|float|float
+	BufferUsage float32 `protobuf:"fixed32,6,opt,name=bufferUsage,proto3" json:"bufferUsage,omitempty"`
+	// Suggested pause in milliseconds before sending more readings, 0 if there is no need to slow down : uint32|int|uint32
+	BackoffMs uint32 `protobuf:"varint,7,opt,name=backoffMs,proto3" json:"backoffMs,omitempty"`
+	// Indicates the publish buffer is full so the oldest buffered readings are being dropped, slow down : bool|bool|bool
+	BufferFull bool `protobuf:"varint,8,opt,name=bufferFull,proto3" json:"bufferFull,omitempty"`
 }
 
 func (x *Reply) Reset() {
@@ -65,13 +130,62 @@ func (*Reply) Descriptor() ([]byte, []int) {
 	return file_protobuf_reading_proto_rawDescGZIP(), []int{0}
 }
 
-func (x *Reply) GetStatus() int32 {
+func (x *Reply) GetStatus() Reply_Status {
 	if x != nil {
 		return x.Status
 	}
+	return Reply_UNKNOWN
+}
+
+func (x *Reply) GetStreamSeq() uint64 {
+	if x != nil {
+		return x.StreamSeq
+	}
+	return 0
+}
+
+func (x *Reply) GetAckedStreamSeq() uint64 {
+	if x != nil {
+		return x.AckedStreamSeq
+	}
+	return 0
+}
+
+func (x *Reply) GetFailedStreamSeqs() []uint64 {
+	if x != nil {
+		return x.FailedStreamSeqs
+	}
+	return nil
+}
+
+func (x *Reply) GetBrokerConnected() bool {
+	if x != nil {
+		return x.BrokerConnected
+	}
+	return false
+}
+
+func (x *Reply) GetBufferUsage() float32 {
+	if x != nil {
+		return x.BufferUsage
+	}
+	return 0
+}
+
+func (x *Reply) GetBackoffMs() uint32 {
+	if x != nil {
+		return x.BackoffMs
+	}
 	return 0
 }
 
+func (x *Reply) GetBufferFull() bool {
+	if x != nil {
+		return x.BufferFull
+	}
+	return false
+}
+
 type Reading struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -99,6 +213,28 @@ type Reading struct {
 	GyroYaw float64 `protobuf:"fixed64,10,opt,name=gyroYaw,proto3" json:"gyroYaw,omitempty"`
 	// Timestamp in unix nanoseconds : *int64|int/long/int64
 	TimeStamp int64 `protobuf:"varint,11,opt,name=timeStamp,proto3" json:"timeStamp,omitempty"`
+	// Sequence number assigned by DataPublisher, increases by one per reading of a client starting from 1 : uint64|int|uint64
+	// Set when the reading is received, whatever a gRPC client sends here is overwritten. Replies refer to readings by stream
+	// sequence number instead, see Reply.streamSeq
+	Seq uint64 `protobuf:"varint,12,opt,name=seq,proto3" json:"seq,omitempty"`
+	// Time DataPublisher started numbering in unix nanoseconds, changes when it restarts and seq starts over : int64|int|int64
+	SeqEpoch int64 `protobuf:"varint,13,opt,name=seqEpoch,proto3" json:"seqEpoch,omitempty"`
+	// Time the device took the sample in unix nanoseconds, set by the device or BLE client, 0 if unknown : int64|int|int64
+	// DataPublisher copies timeStamp here if a client sets timeStamp instead
+	SampleTime int64 `protobuf:"varint,14,opt,name=sampleTime,proto3" json:"sampleTime,omitempty"`
+	// Time DataPublisher received the reading over gRPC in unix nanoseconds, NTP corrected : int64|int|int64
+	ReceiveTime int64 `protobuf:"varint,15,opt,name=receiveTime,proto3" json:"receiveTime,omitempty"`
+	// Time DataPublisher handed the reading to the MQTT client in unix nanoseconds, NTP corrected : int64|int|int64
+	// Later than receiveTime by however long the reading was batched or buffered while the broker was unreachable
+	PublishTime int64 `protobuf:"varint,16,opt,name=publishTime,proto3" json:"publishTime,omitempty"`
+	// Magnetometer reading : *Magnetometer|Magnetometer|Magnetometer
+	Mag *Magnetometer `protobuf:"bytes,17,opt,name=mag,proto3" json:"mag,omitempty"`
+	// Orientation as computed by the device's sensor fusion : *Quaternion|Quaternion|Quaternion
+	Orientation *Quaternion `protobuf:"bytes,18,opt,name=orientation,proto3" json:"orientation,omitempty"`
+	// Battery state : *Battery|Battery|Battery
+	Battery *Battery `protobuf:"bytes,19,opt,name=battery,proto3" json:"battery,omitempty"`
+	// Sampling configuration, devices may send it with the first reading and after changes only : *SensorConfig|SensorConfig|SensorConfig
+	Config *SensorConfig `protobuf:"bytes,20,opt,name=config,proto3" json:"config,omitempty"`
 }
 
 func (x *Reading) Reset() {
@@ -210,39 +346,499 @@ func (x *Reading) GetTimeStamp() int64 {
 	return 0
 }
 
+func (x *Reading) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Reading) GetSeqEpoch() int64 {
+	if x != nil {
+		return x.SeqEpoch
+	}
+	return 0
+}
+
+func (x *Reading) GetSampleTime() int64 {
+	if x != nil {
+		return x.SampleTime
+	}
+	return 0
+}
+
+func (x *Reading) GetReceiveTime() int64 {
+	if x != nil {
+		return x.ReceiveTime
+	}
+	return 0
+}
+
+func (x *Reading) GetPublishTime() int64 {
+	if x != nil {
+		return x.PublishTime
+	}
+	return 0
+}
+
+func (x *Reading) GetMag() *Magnetometer {
+	if x != nil {
+		return x.Mag
+	}
+	return nil
+}
+
+func (x *Reading) GetOrientation() *Quaternion {
+	if x != nil {
+		return x.Orientation
+	}
+	return nil
+}
+
+func (x *Reading) GetBattery() *Battery {
+	if x != nil {
+		return x.Battery
+	}
+	return nil
+}
+
+func (x *Reading) GetConfig() *SensorConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type Magnetometer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Magnetometer X Axis value in microtesla : float64|float|double
+	MagX float64 `protobuf:"fixed64,1,opt,name=magX,proto3" json:"magX,omitempty"`
+	// Magnetometer Y Axis value in microtesla : float64|float|double
+	MagY float64 `protobuf:"fixed64,2,opt,name=magY,proto3" json:"magY,omitempty"`
+	// Magnetometer Z Axis value in microtesla : float64|float|double
+	MagZ float64 `protobuf:"fixed64,3,opt,name=magZ,proto3" json:"magZ,omitempty"`
+}
+
+func (x *Magnetometer) Reset() {
+	*x = Magnetometer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_reading_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Magnetometer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Magnetometer) ProtoMessage() {}
+
+func (x *Magnetometer) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_reading_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Magnetometer.ProtoReflect.Descriptor instead.
+func (*Magnetometer) Descriptor() ([]byte, []int) {
+	return file_protobuf_reading_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Magnetometer) GetMagX() float64 {
+	if x != nil {
+		return x.MagX
+	}
+	return 0
+}
+
+func (x *Magnetometer) GetMagY() float64 {
+	if x != nil {
+		return x.MagY
+	}
+	return 0
+}
+
+func (x *Magnetometer) GetMagZ() float64 {
+	if x != nil {
+		return x.MagZ
+	}
+	return 0
+}
+
+type Quaternion struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Unit quaternion components : float64|float|double
+	W float64 `protobuf:"fixed64,1,opt,name=w,proto3" json:"w,omitempty"`
+	X float64 `protobuf:"fixed64,2,opt,name=x,proto3" json:"x,omitempty"`
+	Y float64 `protobuf:"fixed64,3,opt,name=y,proto3" json:"y,omitempty"`
+	Z float64 `protobuf:"fixed64,4,opt,name=z,proto3" json:"z,omitempty"`
+}
+
+func (x *Quaternion) Reset() {
+	*x = Quaternion{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_reading_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Quaternion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Quaternion) ProtoMessage() {}
+
+func (x *Quaternion) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_reading_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Quaternion.ProtoReflect.Descriptor instead.
+func (*Quaternion) Descriptor() ([]byte, []int) {
+	return file_protobuf_reading_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Quaternion) GetW() float64 {
+	if x != nil {
+		return x.W
+	}
+	return 0
+}
+
+func (x *Quaternion) GetX() float64 {
+	if x != nil {
+		return x.X
+	}
+	return 0
+}
+
+func (x *Quaternion) GetY() float64 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *Quaternion) GetZ() float64 {
+	if x != nil {
+		return x.Z
+	}
+	return 0
+}
+
+type Battery struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Charge left from 0 to 1 : float32|float|float
+	Level float32 `protobuf:"fixed32,1,opt,name=level,proto3" json:"level,omitempty"`
+	// Battery voltage in millivolts, 0 if unknown : uint32|int|uint32
+	Millivolts uint32 `protobuf:"varint,2,opt,name=millivolts,proto3" json:"millivolts,omitempty"`
+	// Indicates if the device is charging : bool|bool|bool
+	Charging bool `protobuf:"varint,3,opt,name=charging,proto3" json:"charging,omitempty"`
+}
+
+func (x *Battery) Reset() {
+	*x = Battery{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_reading_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Battery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Battery) ProtoMessage() {}
+
+func (x *Battery) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_reading_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Battery.ProtoReflect.Descriptor instead.
+func (*Battery) Descriptor() ([]byte, []int) {
+	return file_protobuf_reading_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Battery) GetLevel() float32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *Battery) GetMillivolts() uint32 {
+	if x != nil {
+		return x.Millivolts
+	}
+	return 0
+}
+
+func (x *Battery) GetCharging() bool {
+	if x != nil {
+		return x.Charging
+	}
+	return false
+}
+
+type SensorConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Samples per second : uint32|int|uint32
+	SampleRateHz uint32 `protobuf:"varint,1,opt,name=sampleRateHz,proto3" json:"sampleRateHz,omitempty"`
+	// Accelerometer full scale range in g, 0 if unknown : uint32|int|uint32
+	AccRangeG uint32 `protobuf:"varint,2,opt,name=accRangeG,proto3" json:"accRangeG,omitempty"`
+	// Gyroscope full scale range in degrees per second, 0 if unknown : uint32|int|uint32
+	GyroRangeDps uint32 `protobuf:"varint,3,opt,name=gyroRangeDps,proto3" json:"gyroRangeDps,omitempty"`
+	// Device firmware version : string|str|string
+	Firmware string `protobuf:"bytes,4,opt,name=firmware,proto3" json:"firmware,omitempty"`
+}
+
+func (x *SensorConfig) Reset() {
+	*x = SensorConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_reading_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SensorConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SensorConfig) ProtoMessage() {}
+
+func (x *SensorConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_reading_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SensorConfig.ProtoReflect.Descriptor instead.
+func (*SensorConfig) Descriptor() ([]byte, []int) {
+	return file_protobuf_reading_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SensorConfig) GetSampleRateHz() uint32 {
+	if x != nil {
+		return x.SampleRateHz
+	}
+	return 0
+}
+
+func (x *SensorConfig) GetAccRangeG() uint32 {
+	if x != nil {
+		return x.AccRangeG
+	}
+	return 0
+}
+
+func (x *SensorConfig) GetGyroRangeDps() uint32 {
+	if x != nil {
+		return x.GyroRangeDps
+	}
+	return 0
+}
+
+func (x *SensorConfig) GetFirmware() string {
+	if x != nil {
+		return x.Firmware
+	}
+	return ""
+}
+
+type ReadingBatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Readings in the order they were taken, all from the same client : []*Reading|list|RepeatedPtrField<Reading>
+	Readings []*Reading `protobuf:"bytes,1,rep,name=readings,proto3" json:"readings,omitempty"`
+}
+
+func (x *ReadingBatch) Reset() {
+	*x = ReadingBatch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_protobuf_reading_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReadingBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReadingBatch) ProtoMessage() {}
+
+func (x *ReadingBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_protobuf_reading_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReadingBatch.ProtoReflect.Descriptor instead.
+func (*ReadingBatch) Descriptor() ([]byte, []int) {
+	return file_protobuf_reading_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReadingBatch) GetReadings() []*Reading {
+	if x != nil {
+		return x.Readings
+	}
+	return nil
+}
+
 var File_protobuf_reading_proto protoreflect.FileDescriptor
 
 var file_protobuf_reading_proto_rawDesc = []byte{
 	0x0a, 0x16, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x72, 0x65, 0x61, 0x64, 0x69,
-	0x6e, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02, 0x70, 0x62, 0x22, 0x1f, 0x0a, 0x05,
-	0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0xaf, 0x02,
-	0x0a, 0x07, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x20, 0x0a, 0x0b, 0x69, 0x73, 0x53,
-	0x74, 0x61, 0x72, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b,
-	0x69, 0x73, 0x53, 0x74, 0x61, 0x72, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x63,
-	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63,
-	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x61, 0x6e, 0x63, 0x65,
-	0x72, 0x4e, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x64, 0x61, 0x6e, 0x63, 0x65,
-	0x72, 0x4e, 0x6f, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x6f, 0x73, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65,
-	0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x70, 0x6f, 0x73, 0x43, 0x68, 0x61, 0x6e, 0x67,
-	0x65, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x63, 0x63, 0x58, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52,
-	0x04, 0x61, 0x63, 0x63, 0x58, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x63, 0x63, 0x59, 0x18, 0x06, 0x20,
-	0x01, 0x28, 0x01, 0x52, 0x04, 0x61, 0x63, 0x63, 0x59, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x63, 0x63,
-	0x5a, 0x18, 0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x61, 0x63, 0x63, 0x5a, 0x12, 0x1a, 0x0a,
-	0x08, 0x67, 0x79, 0x72, 0x6f, 0x52, 0x6f, 0x6c, 0x6c, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01, 0x52,
-	0x08, 0x67, 0x79, 0x72, 0x6f, 0x52, 0x6f, 0x6c, 0x6c, 0x12, 0x1c, 0x0a, 0x09, 0x67, 0x79, 0x72,
-	0x6f, 0x50, 0x69, 0x74, 0x63, 0x68, 0x18, 0x09, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x67, 0x79,
-	0x72, 0x6f, 0x50, 0x69, 0x74, 0x63, 0x68, 0x12, 0x18, 0x0a, 0x07, 0x67, 0x79, 0x72, 0x6f, 0x59,
-	0x61, 0x77, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x67, 0x79, 0x72, 0x6f, 0x59, 0x61,
-	0x77, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x0b,
-	0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x6d, 0x70, 0x32,
-	0x37, 0x0a, 0x06, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x12, 0x2d, 0x0a, 0x0d, 0x52, 0x65, 0x61,
-	0x64, 0x69, 0x6e, 0x67, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x0b, 0x2e, 0x70, 0x62, 0x2e,
-	0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x1a, 0x09, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x70,
-	0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68,
-	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x51, 0x7a, 0x53, 0x47, 0x2f, 0x6c, 0x61, 0x70, 0x69,
-	0x73, 0x2d, 0x75, 0x6e, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x3b, 0x70,
-	0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6e, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02, 0x70, 0x62, 0x22, 0xd0, 0x02, 0x0a,
+	0x05, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x28, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x10, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x12, 0x1c, 0x0a, 0x09, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x71, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x09, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x71, 0x12, 0x26,
+	0x0a, 0x0e, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x71,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0e, 0x61, 0x63, 0x6b, 0x65, 0x64, 0x53, 0x74, 0x72,
+	0x65, 0x61, 0x6d, 0x53, 0x65, 0x71, 0x12, 0x2a, 0x0a, 0x10, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65, 0x71, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x04,
+	0x52, 0x10, 0x66, 0x61, 0x69, 0x6c, 0x65, 0x64, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x53, 0x65,
+	0x71, 0x73, 0x12, 0x28, 0x0a, 0x0f, 0x62, 0x72, 0x6f, 0x6b, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e,
+	0x65, 0x63, 0x74, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x62, 0x72, 0x6f,
+	0x6b, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x65, 0x64, 0x12, 0x20, 0x0a, 0x0b,
+	0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x55, 0x73, 0x61, 0x67, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x02, 0x52, 0x0b, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x55, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1c,
+	0x0a, 0x09, 0x62, 0x61, 0x63, 0x6b, 0x6f, 0x66, 0x66, 0x4d, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x09, 0x62, 0x61, 0x63, 0x6b, 0x6f, 0x66, 0x66, 0x4d, 0x73, 0x12, 0x1e, 0x0a, 0x0a,
+	0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x46, 0x75, 0x6c, 0x6c, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0a, 0x62, 0x75, 0x66, 0x66, 0x65, 0x72, 0x46, 0x75, 0x6c, 0x6c, 0x22, 0x21, 0x0a, 0x06,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57,
+	0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x51, 0x55, 0x45, 0x55, 0x45, 0x44, 0x10, 0x01, 0x22,
+	0xe8, 0x04, 0x0a, 0x07, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x20, 0x0a, 0x0b, 0x69,
+	0x73, 0x53, 0x74, 0x61, 0x72, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x0b, 0x69, 0x73, 0x53, 0x74, 0x61, 0x72, 0x74, 0x4d, 0x6f, 0x76, 0x65, 0x12, 0x1a, 0x0a,
+	0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x61, 0x6e,
+	0x63, 0x65, 0x72, 0x4e, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x64, 0x61, 0x6e,
+	0x63, 0x65, 0x72, 0x4e, 0x6f, 0x12, 0x1c, 0x0a, 0x09, 0x70, 0x6f, 0x73, 0x43, 0x68, 0x61, 0x6e,
+	0x67, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x70, 0x6f, 0x73, 0x43, 0x68, 0x61,
+	0x6e, 0x67, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x63, 0x63, 0x58, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x04, 0x61, 0x63, 0x63, 0x58, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x63, 0x63, 0x59, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x61, 0x63, 0x63, 0x59, 0x12, 0x12, 0x0a, 0x04, 0x61,
+	0x63, 0x63, 0x5a, 0x18, 0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x61, 0x63, 0x63, 0x5a, 0x12,
+	0x1a, 0x0a, 0x08, 0x67, 0x79, 0x72, 0x6f, 0x52, 0x6f, 0x6c, 0x6c, 0x18, 0x08, 0x20, 0x01, 0x28,
+	0x01, 0x52, 0x08, 0x67, 0x79, 0x72, 0x6f, 0x52, 0x6f, 0x6c, 0x6c, 0x12, 0x1c, 0x0a, 0x09, 0x67,
+	0x79, 0x72, 0x6f, 0x50, 0x69, 0x74, 0x63, 0x68, 0x18, 0x09, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09,
+	0x67, 0x79, 0x72, 0x6f, 0x50, 0x69, 0x74, 0x63, 0x68, 0x12, 0x18, 0x0a, 0x07, 0x67, 0x79, 0x72,
+	0x6f, 0x59, 0x61, 0x77, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x67, 0x79, 0x72, 0x6f,
+	0x59, 0x61, 0x77, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x6d, 0x70,
+	0x18, 0x0b, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x6d,
+	0x70, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03,
+	0x73, 0x65, 0x71, 0x12, 0x1a, 0x0a, 0x08, 0x73, 0x65, 0x71, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x18,
+	0x0d, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x73, 0x65, 0x71, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x12,
+	0x1e, 0x0a, 0x0a, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x0e, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x0a, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12,
+	0x20, 0x0a, 0x0b, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x18, 0x0f,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x54, 0x69, 0x6d,
+	0x65, 0x12, 0x20, 0x0a, 0x0b, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x54, 0x69, 0x6d, 0x65,
+	0x18, 0x10, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x54,
+	0x69, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x03, 0x6d, 0x61, 0x67, 0x18, 0x11, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x70, 0x62, 0x2e, 0x4d, 0x61, 0x67, 0x6e, 0x65, 0x74, 0x6f, 0x6d, 0x65, 0x74,
+	0x65, 0x72, 0x52, 0x03, 0x6d, 0x61, 0x67, 0x12, 0x30, 0x0a, 0x0b, 0x6f, 0x72, 0x69, 0x65, 0x6e,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x12, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70,
+	0x62, 0x2e, 0x51, 0x75, 0x61, 0x74, 0x65, 0x72, 0x6e, 0x69, 0x6f, 0x6e, 0x52, 0x0b, 0x6f, 0x72,
+	0x69, 0x65, 0x6e, 0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x25, 0x0a, 0x07, 0x62, 0x61, 0x74,
+	0x74, 0x65, 0x72, 0x79, 0x18, 0x13, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x70, 0x62, 0x2e,
+	0x42, 0x61, 0x74, 0x74, 0x65, 0x72, 0x79, 0x52, 0x07, 0x62, 0x61, 0x74, 0x74, 0x65, 0x72, 0x79,
+	0x12, 0x28, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x18, 0x14, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x70, 0x62, 0x2e, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x22, 0x4a, 0x0a, 0x0c, 0x4d, 0x61,
+	0x67, 0x6e, 0x65, 0x74, 0x6f, 0x6d, 0x65, 0x74, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x6d, 0x61,
+	0x67, 0x58, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x6d, 0x61, 0x67, 0x58, 0x12, 0x12,
+	0x0a, 0x04, 0x6d, 0x61, 0x67, 0x59, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x04, 0x6d, 0x61,
+	0x67, 0x59, 0x12, 0x12, 0x0a, 0x04, 0x6d, 0x61, 0x67, 0x5a, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x04, 0x6d, 0x61, 0x67, 0x5a, 0x22, 0x44, 0x0a, 0x0a, 0x51, 0x75, 0x61, 0x74, 0x65, 0x72,
+	0x6e, 0x69, 0x6f, 0x6e, 0x12, 0x0c, 0x0a, 0x01, 0x77, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x01, 0x77, 0x12, 0x0c, 0x0a, 0x01, 0x78, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x78,
+	0x12, 0x0c, 0x0a, 0x01, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x79, 0x12, 0x0c,
+	0x0a, 0x01, 0x7a, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x7a, 0x22, 0x5b, 0x0a, 0x07,
+	0x42, 0x61, 0x74, 0x74, 0x65, 0x72, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x02, 0x52, 0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x12, 0x1e, 0x0a,
+	0x0a, 0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x76, 0x6f, 0x6c, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x0a, 0x6d, 0x69, 0x6c, 0x6c, 0x69, 0x76, 0x6f, 0x6c, 0x74, 0x73, 0x12, 0x1a, 0x0a,
+	0x08, 0x63, 0x68, 0x61, 0x72, 0x67, 0x69, 0x6e, 0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x08, 0x63, 0x68, 0x61, 0x72, 0x67, 0x69, 0x6e, 0x67, 0x22, 0x90, 0x01, 0x0a, 0x0c, 0x53, 0x65,
+	0x6e, 0x73, 0x6f, 0x72, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x61,
+	0x6d, 0x70, 0x6c, 0x65, 0x52, 0x61, 0x74, 0x65, 0x48, 0x7a, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0c, 0x73, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x52, 0x61, 0x74, 0x65, 0x48, 0x7a, 0x12, 0x1c,
+	0x0a, 0x09, 0x61, 0x63, 0x63, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x47, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x09, 0x61, 0x63, 0x63, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x47, 0x12, 0x22, 0x0a, 0x0c,
+	0x67, 0x79, 0x72, 0x6f, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x44, 0x70, 0x73, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x0c, 0x67, 0x79, 0x72, 0x6f, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x44, 0x70, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x66, 0x69, 0x72, 0x6d, 0x77, 0x61, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x66, 0x69, 0x72, 0x6d, 0x77, 0x61, 0x72, 0x65, 0x22, 0x37, 0x0a, 0x0c,
+	0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x27, 0x0a, 0x08,
+	0x72, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b,
+	0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x52, 0x08, 0x72, 0x65, 0x61,
+	0x64, 0x69, 0x6e, 0x67, 0x73, 0x32, 0x70, 0x0a, 0x06, 0x53, 0x65, 0x6e, 0x73, 0x6f, 0x72, 0x12,
+	0x2d, 0x0a, 0x0d, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d,
+	0x12, 0x0b, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x1a, 0x09, 0x2e,
+	0x70, 0x62, 0x2e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x12, 0x37,
+	0x0a, 0x12, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e, 0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x12, 0x10, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x69, 0x6e,
+	0x67, 0x42, 0x61, 0x74, 0x63, 0x68, 0x1a, 0x09, 0x2e, 0x70, 0x62, 0x2e, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x27, 0x5a, 0x25, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x51, 0x7a, 0x53, 0x47, 0x2f, 0x6c, 0x61, 0x70, 0x69, 0x73,
+	0x2d, 0x75, 0x6e, 0x6f, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x3b, 0x70, 0x62,
+	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -257,19 +853,34 @@ func file_protobuf_reading_proto_rawDescGZIP() []byte {
 	return file_protobuf_reading_proto_rawDescData
 }
 
-var file_protobuf_reading_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_protobuf_reading_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_protobuf_reading_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_protobuf_reading_proto_goTypes = []interface{}{
-	(*Reply)(nil),   // 0: pb.Reply
-	(*Reading)(nil), // 1: pb.Reading
+	(Reply_Status)(0),    // 0: pb.Reply.Status
+	(*Reply)(nil),        // 1: pb.Reply
+	(*Reading)(nil),      // 2: pb.Reading
+	(*Magnetometer)(nil), // 3: pb.Magnetometer
+	(*Quaternion)(nil),   // 4: pb.Quaternion
+	(*Battery)(nil),      // 5: pb.Battery
+	(*SensorConfig)(nil), // 6: pb.SensorConfig
+	(*ReadingBatch)(nil), // 7: pb.ReadingBatch
 }
 var file_protobuf_reading_proto_depIdxs = []int32{
-	1, // 0: pb.Sensor.ReadingStream:input_type -> pb.Reading
-	0, // 1: pb.Sensor.ReadingStream:output_type -> pb.Reply
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: pb.Reply.status:type_name -> pb.Reply.Status
+	3, // 1: pb.Reading.mag:type_name -> pb.Magnetometer
+	4, // 2: pb.Reading.orientation:type_name -> pb.Quaternion
+	5, // 3: pb.Reading.battery:type_name -> pb.Battery
+	6, // 4: pb.Reading.config:type_name -> pb.SensorConfig
+	2, // 5: pb.ReadingBatch.readings:type_name -> pb.Reading
+	2, // 6: pb.Sensor.ReadingStream:input_type -> pb.Reading
+	7, // 7: pb.Sensor.ReadingBatchStream:input_type -> pb.ReadingBatch
+	1, // 8: pb.Sensor.ReadingStream:output_type -> pb.Reply
+	1, // 9: pb.Sensor.ReadingBatchStream:output_type -> pb.Reply
+	8, // [8:10] is the sub-list for method output_type
+	6, // [6:8] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_protobuf_reading_proto_init() }
@@ -302,19 +913,80 @@ func file_protobuf_reading_proto_init() {
 				return nil
 			}
 		}
+		file_protobuf_reading_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Magnetometer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_reading_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Quaternion); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_reading_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Battery); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_reading_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SensorConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_protobuf_reading_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReadingBatch); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_protobuf_reading_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      1,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_protobuf_reading_proto_goTypes,
 		DependencyIndexes: file_protobuf_reading_proto_depIdxs,
+		EnumInfos:         file_protobuf_reading_proto_enumTypes,
 		MessageInfos:      file_protobuf_reading_proto_msgTypes,
 	}.Build()
 	File_protobuf_reading_proto = out.File
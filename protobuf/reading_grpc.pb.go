@@ -19,6 +19,8 @@ const _ = grpc.SupportPackageIsVersion7
 type SensorClient interface {
 	// Sends a greeting
 	ReadingStream(ctx context.Context, opts ...grpc.CallOption) (Sensor_ReadingStreamClient, error)
+	// Sends readings in batches, one Reply per batch
+	ReadingBatchStream(ctx context.Context, opts ...grpc.CallOption) (Sensor_ReadingBatchStreamClient, error)
 }
 
 type sensorClient struct {
@@ -60,12 +62,45 @@ func (x *sensorReadingStreamClient) Recv() (*Reply, error) {
 	return m, nil
 }
 
+func (c *sensorClient) ReadingBatchStream(ctx context.Context, opts ...grpc.CallOption) (Sensor_ReadingBatchStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Sensor_serviceDesc.Streams[1], "/pb.Sensor/ReadingBatchStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sensorReadingBatchStreamClient{stream}
+	return x, nil
+}
+
+type Sensor_ReadingBatchStreamClient interface {
+	Send(*ReadingBatch) error
+	Recv() (*Reply, error)
+	grpc.ClientStream
+}
+
+type sensorReadingBatchStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *sensorReadingBatchStreamClient) Send(m *ReadingBatch) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *sensorReadingBatchStreamClient) Recv() (*Reply, error) {
+	m := new(Reply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // SensorServer is the server API for Sensor service.
 // All implementations must embed UnimplementedSensorServer
 // for forward compatibility
 type SensorServer interface {
 	// Sends a greeting
 	ReadingStream(Sensor_ReadingStreamServer) error
+	// Sends readings in batches, one Reply per batch
+	ReadingBatchStream(Sensor_ReadingBatchStreamServer) error
 	mustEmbedUnimplementedSensorServer()
 }
 
@@ -76,6 +111,9 @@ type UnimplementedSensorServer struct {
 func (UnimplementedSensorServer) ReadingStream(Sensor_ReadingStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method ReadingStream not implemented")
 }
+func (UnimplementedSensorServer) ReadingBatchStream(Sensor_ReadingBatchStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ReadingBatchStream not implemented")
+}
 func (UnimplementedSensorServer) mustEmbedUnimplementedSensorServer() {}
 
 // UnsafeSensorServer may be embedded to opt out of forward compatibility for this service.
@@ -115,6 +153,32 @@ func (x *sensorReadingStreamServer) Recv() (*Reading, error) {
 	return m, nil
 }
 
+func _Sensor_ReadingBatchStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SensorServer).ReadingBatchStream(&sensorReadingBatchStreamServer{stream})
+}
+
+type Sensor_ReadingBatchStreamServer interface {
+	Send(*Reply) error
+	Recv() (*ReadingBatch, error)
+	grpc.ServerStream
+}
+
+type sensorReadingBatchStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *sensorReadingBatchStreamServer) Send(m *Reply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *sensorReadingBatchStreamServer) Recv() (*ReadingBatch, error) {
+	m := new(ReadingBatch)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _Sensor_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "pb.Sensor",
 	HandlerType: (*SensorServer)(nil),
@@ -126,6 +190,12 @@ var _Sensor_serviceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "ReadingBatchStream",
+			Handler:       _Sensor_ReadingBatchStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "protobuf/reading.proto",
 }